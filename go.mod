@@ -18,7 +18,6 @@ require (
 )
 
 require (
-	github.com/adhocore/gronx v1.19.6 // indirect
 	github.com/cockroachdb/apd/v3 v3.2.1 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.2.0 // indirect
@@ -36,7 +35,6 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rickb777/date v1.14.2 // indirect
 	github.com/rickb777/plural v1.2.2 // indirect
-	github.com/rs/xid v1.5.0 // indirect
 	github.com/segmentio/asm v1.2.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	golang.org/x/crypto v0.21.0 // indirect
@@ -47,7 +45,9 @@ require (
 )
 
 require (
+	github.com/adhocore/gronx v1.19.6
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/gorilla/websocket v1.5.3
 	github.com/hmdsefi/gograph v0.4.2
+	github.com/rs/xid v1.5.0
 )
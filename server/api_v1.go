@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ross96D/updater/logger"
+	"github.com/ross96D/updater/server/auth"
+	"github.com/ross96D/updater/server/user_handler"
+	"github.com/ross96D/updater/share"
+	"github.com/ross96D/updater/share/configuration"
+	"github.com/ross96D/updater/share/match"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// setAPIHandlers mounts the versioned api. The apps are addressed by name, see openapi.json
+func (s *Server) setAPIHandlers() {
+	s.router.Route("/api/v1", func(r chi.Router) {
+		r.Get("/openapi.json", OpenAPI)
+		r.Post("/login", Login)
+		r.Group(func(r chi.Router) {
+			r.Use(auth.AuthMiddelware)
+			r.Use(userOnly)
+			r.Get("/apps", APIApps)
+			r.Get("/apps/{name}", APIApp)
+			r.Post("/apps/{name}/update", APIUpdateApp)
+			r.Get("/apps/{name}/status", AppStatus)
+			r.Post("/apps/{name}/rollback", Rollback)
+			r.Get("/apps/{name}/cron", AppCron)
+			r.Get("/apps/{name}/jobs", AppJobs)
+			r.Post("/apps/{name}/jobs/{job}/run", RunJob)
+			r.Post("/apps/{name}/jobs/{job}/pause", PauseJob)
+			r.Post("/apps/{name}/jobs/{job}/resume", ResumeJob)
+			r.Get("/config", Config)
+			r.Get("/config/files", ConfigFiles)
+			r.Post("/reload", APIReload)
+			r.Get("/updates", ListUpdates)
+			r.Get("/updates/{id}", GetUpdate)
+			r.Post("/updates/{id}/cancel", CancelUpdate)
+		})
+	})
+}
+
+// userOnly rejects the requests authenticated with the token of an app
+func userOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(auth.TypeKey) != "user" {
+			http.Error(w, "", 403)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// OpenAPI serves the OpenAPI document of the api
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(openAPI); err != nil {
+		log.Error().Err(err).Msg("sending openapi document")
+	}
+}
+
+// APIAppList is the response of GET /api/v1/apps
+type APIAppList struct {
+	Apps    []configuration.Application `json:"apps"`
+	Version share.VersionData           `json:"version"`
+}
+
+// APIApps lists the apps of the configuration, the ones without a name can not be addressed by the api
+func APIApps(w http.ResponseWriter, r *http.Request) {
+	sendAPIApps(w)
+}
+
+func sendAPIApps(w http.ResponseWriter) {
+	list := APIAppList{Apps: share.Config().Apps, Version: share.Version()}
+	if list.Apps == nil {
+		list.Apps = []configuration.Application{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		log.Error().Err(err).Msg("sending apps")
+	}
+}
+
+// APIApp returns the configuration of an app
+func APIApp(w http.ResponseWriter, r *http.Request) {
+	app, err := share.Config().FindAppByName(chi.URLParam(r, "name"))
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(app); err != nil {
+		log.Error().Err(err).Msg("sending app")
+	}
+}
+
+// APIUpdateApp updates an app with the latest release of his github repository, streaming the update log
+func APIUpdateApp(w http.ResponseWriter, r *http.Request) {
+	app, err := share.Config().FindAppByName(chi.URLParam(r, "name"))
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	dryRun := r.Header.Get("dry-run") == "true"
+
+	logger.ResponseWithLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streamUpdate(w, r, func(ctx context.Context, logger *zerolog.Logger) (match.Result, bool) {
+			logger.Info().Bool("dry-run", dryRun).Send()
+			return user_handler.UpdateApp(ctx, app, dryRun), true
+		})
+	})).ServeHTTP(w, r)
+}
+
+// APIReload replaces a configuration file, like /reload, and answers with the apps.
+// The configuration errors are always sent as json
+func APIReload(w http.ResponseWriter, r *http.Request) {
+	if !reloadConfigFile(w, r, true) {
+		return
+	}
+	sendAPIApps(w)
+}
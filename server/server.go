@@ -3,6 +3,8 @@ package server
 import (
 	"context"
 	_ "embed"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
@@ -10,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -64,10 +67,21 @@ func (s *Server) setHandlers() {
 		r.Use(auth.AuthMiddelware)
 		r.Get("/list", List)
 		r.Get("/config", Config)
+		r.Get("/config/files", ConfigFiles)
 		r.Group(func(r chi.Router) {
 			r.Use(logger.ResponseWithLogger)
 			r.Post("/update", Update)
 		})
+		r.Get("/apps/{name}/status", AppStatus)
+		r.Get("/apps/{name}/cron", AppCron)
+		r.Post("/apps/{name}/rollback", Rollback)
+		r.Get("/apps/{name}/jobs", AppJobs)
+		r.Post("/apps/{name}/jobs/{job}/run", RunJob)
+		r.Post("/apps/{name}/jobs/{job}/pause", PauseJob)
+		r.Post("/apps/{name}/jobs/{job}/resume", ResumeJob)
+		r.Get("/updates", ListUpdates)
+		r.Get("/updates/{id}", GetUpdate)
+		r.Post("/updates/{id}/cancel", CancelUpdate)
 		r.Post("/reload", ReloadConfig)
 		r.Post("/upgrade", Upgrade)
 	})
@@ -75,6 +89,7 @@ func (s *Server) setHandlers() {
 		webpage.WebHandlers(r)
 	})
 	s.router.Post("/login", Login)
+	s.setAPIHandlers()
 }
 
 func Upgrade(w http.ResponseWriter, r *http.Request) {
@@ -104,12 +119,18 @@ func Upgrade(w http.ResponseWriter, r *http.Request) {
 }
 
 func Config(w http.ResponseWriter, r *http.Request) {
-	data, err := share.ReadConfigFile()
+	path, err := share.ConfigFilePath(r.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	data, err := os.ReadFile(path)
 	if err != nil {
 		log.Error().Err(err).Send()
 		http.Error(w, err.Error(), 500)
 		return
 	}
+	w.Header().Set("Content-Type", configuration.FormatFromPath(path).ContentType())
 	w.WriteHeader(200)
 	_, err = w.Write(data)
 	if err != nil {
@@ -117,7 +138,40 @@ func Config(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func ConfigFiles(w http.ResponseWriter, r *http.Request) {
+	files, err := share.ConfigFiles()
+	if err != nil {
+		log.Error().Err(err).Send()
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(files); err != nil {
+		log.Error().Err(err).Msg("sending config files")
+	}
+}
+
 func ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	jsonErrors := strings.Contains(r.Header.Get("Accept"), "application/json")
+	if !reloadConfigFile(w, r, jsonErrors) {
+		return
+	}
+	err := user_handler.HandleUserAppsList(w)
+	if err != nil {
+		// log here
+		// maybe this is not necesary? this would panic or error or something like that
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+// reloadConfigFile replaces the configuration file of the file query parameter with the body of the request
+// if the new configuration is valid. On failure the error is sent, as json if jsonErrors is set, and ok is false
+func reloadConfigFile(w http.ResponseWriter, r *http.Request, jsonErrors bool) (ok bool) {
+	path, err := share.ConfigFilePath(r.URL.Query().Get("file"))
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
 	data, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Error().Err(err).Send()
@@ -129,22 +183,39 @@ func ReloadConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = share.ReloadString(string(data))
+	err = share.ReloadFile(path, data)
 	if err != nil {
-		http.Error(w, err.Error(), 400)
+		if jsonErrors {
+			configErrors(w, err)
+		} else {
+			http.Error(w, err.Error(), 400)
+		}
 		return
 	}
-	err = share.ReplaceConfigFile(data)
+	err = share.ReplaceConfigFileAt(path, data)
 	if err != nil {
 		log.Error().Err(err).Msg("replacing config file")
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	err = user_handler.HandleUserAppsList(w)
-	if err != nil {
-		// log here
-		// maybe this is not necesary? this would panic or error or something like that
-		http.Error(w, err.Error(), 500)
+	return true
+}
+
+type ConfigErrors struct {
+	Errors configuration.ValidationErrors `json:"errors"`
+}
+
+// configErrors sends the configuration validation errors as json
+func configErrors(w http.ResponseWriter, err error) {
+	var errs configuration.ValidationErrors
+	if !errors.As(err, &errs) {
+		errs = configuration.ValidationErrors{{Message: err.Error()}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(400)
+	if err = json.NewEncoder(w).Encode(ConfigErrors{Errors: errs}); err != nil {
+		log.Error().Err(err).Msg("sending config errors")
 	}
 }
 
@@ -188,22 +259,209 @@ func List(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Update(w http.ResponseWriter, r *http.Request) {
-	requestCtx := r.Context()
-	childCtx := context.WithoutCancel(requestCtx)
-	// TODO make this configurable
-	timeout := time.NewTimer(60 * time.Second)
-	taskChan := make(chan struct{}, 0)
+// AppStatus returns the state of the services and deployed files of an application and his last update
+func AppStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(auth.TypeKey) != "user" {
+		http.Error(w, "", 403)
+		return
+	}
+	app, err := share.Config().FindAppByName(chi.URLParam(r, "name"))
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(match.GetAppStatus(app)); err != nil {
+		log.Error().Err(err).Msg("sending app status")
+	}
+}
 
-	logger, handler := logger.LoggerCtx_FromContext(childCtx)
+// Rollback switches a blue/green application back to his previous color and returns the result
+func Rollback(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(auth.TypeKey) != "user" {
+		http.Error(w, "", 403)
+		return
+	}
+	app, err := share.Config().FindAppByName(chi.URLParam(r, "name"))
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	ctx := logger.LoggerCtx_WithContex(context.WithoutCancel(r.Context()), &log.Logger, nil)
+	result := match.Rollback(ctx, app)
+	for _, err := range []error{match.ErrNotBlueGreen, match.ErrNoPreviousColor} {
+		if result.Contains(err) {
+			http.Error(w, err.Error(), 409)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if result.Status != match.UpdateSuccess {
+		w.WriteHeader(500)
+	}
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		log.Error().Err(err).Msg("sending rollback result")
+	}
+}
+
+// AppCron returns the cron jobs installed for an application
+func AppCron(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(auth.TypeKey) != "user" {
+		http.Error(w, "", 403)
+		return
+	}
+	app, err := share.Config().FindAppByName(chi.URLParam(r, "name"))
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	tab, err := match.InstalledCronJobs(app.Name)
+	if err != nil {
+		log.Error().Err(err).Send()
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(tab); err != nil {
+		log.Error().Err(err).Msg("sending cron jobs")
+	}
+}
+
+// appScheduler returns the application of the request and the builtin scheduler.
+// If it fails an error response is sent
+func appScheduler(w http.ResponseWriter, r *http.Request) (*match.Scheduler, configuration.Application, bool) {
+	if r.Context().Value(auth.TypeKey) != "user" {
+		http.Error(w, "", 403)
+		return nil, configuration.Application{}, false
+	}
+	app, err := share.Config().FindAppByName(chi.URLParam(r, "name"))
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return nil, app, false
+	}
+	scheduler, ok := match.CurrentCronBackend().(*match.Scheduler)
+	if !ok {
+		http.Error(w, "the jobs api needs the builtin cron backend", 409)
+		return nil, app, false
+	}
+	return scheduler, app, true
+}
+
+// AppJobs returns the jobs of an application with his next run and run history
+func AppJobs(w http.ResponseWriter, r *http.Request) {
+	scheduler, app, ok := appScheduler(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(scheduler.Jobs(app.Name)); err != nil {
+		log.Error().Err(err).Msg("sending jobs")
+	}
+}
 
+// RunJob runs a job of an application now
+func RunJob(w http.ResponseWriter, r *http.Request) {
+	scheduler, app, ok := appScheduler(w, r)
+	if !ok {
+		return
+	}
+	job := chi.URLParam(r, "job")
+	err := scheduler.Trigger(app.Name, job)
+	if err != nil {
+		jobError(w, err)
+		return
+	}
+	log.Info().Str("app", app.Name).Str("job", job).Msg("job run requested")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func PauseJob(w http.ResponseWriter, r *http.Request) {
+	pauseJob(w, r, true)
+}
+
+func ResumeJob(w http.ResponseWriter, r *http.Request) {
+	pauseJob(w, r, false)
+}
+
+func pauseJob(w http.ResponseWriter, r *http.Request, paused bool) {
+	scheduler, app, ok := appScheduler(w, r)
+	if !ok {
+		return
+	}
+	job := chi.URLParam(r, "job")
+	if err := scheduler.Pause(app.Name, job, paused); err != nil {
+		jobError(w, err)
+		return
+	}
+	log.Info().Str("app", app.Name).Str("job", job).Bool("paused", paused).Msg("job paused state changed")
+	w.WriteHeader(http.StatusOK)
+}
+
+func jobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, match.ErrJobNotFound):
+		http.Error(w, err.Error(), 404)
+	case errors.Is(err, match.ErrJobRunning):
+		http.Error(w, err.Error(), 409)
+	default:
+		log.Error().Err(err).Send()
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+func ListUpdates(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(auth.TypeKey) != "user" {
+		http.Error(w, "", 403)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(match.Updates()); err != nil {
+		log.Error().Err(err).Msg("sending updates")
+	}
+}
+
+// GetUpdate returns an update with the exit code, duration and output tails of his commands
+func GetUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(auth.TypeKey) != "user" {
+		http.Error(w, "", 403)
+		return
+	}
+	info, err := match.FindUpdate(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(info); err != nil {
+		log.Error().Err(err).Msg("sending update")
+	}
+}
+
+// CancelUpdate cancels a running update. The id of an update is the Request-Id header of the /update response
+func CancelUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(auth.TypeKey) != "user" {
+		http.Error(w, "", 403)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	err := match.CancelUpdate(id)
+	if errors.Is(err, match.ErrUpdateNotFound) {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	log.Info().Str("update", id).Msg("update cancel requested")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func Update(w http.ResponseWriter, r *http.Request) {
 	dryRun := r.Header.Get("dry-run") == "true"
+	release := match.Release{Tag: r.Header.Get("release-tag")}
 
-	go func(ctx context.Context, channel chan<- struct{}) {
-		defer func() {
-			handler.End()
-			channel <- struct{}{}
-		}()
+	streamUpdate(w, r, func(ctx context.Context, logger *zerolog.Logger) (match.Result, bool) {
 		switch r.Context().Value(auth.TypeKey) {
 		case "webhook":
 			app := ctx.Value(auth.AppValueKey).(configuration.Application)
@@ -213,41 +471,54 @@ func Update(w http.ResponseWriter, r *http.Request) {
 			logger.Info().Bool("dry-run", dryRun).Send()
 			if err != nil {
 				logger.Error().Err(err).Msg("ParseForm")
-				return
+				return match.Result{}, false
 			}
 
-			joinerr := match.Update(ctx, app, match.WithData(data), match.WithDryRun(dryRun))
-
-			if joinerr.IsNotEmpty() {
-				logger := logger.With().Logger()
-				logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-					return c.Str("reqID", utils.Ignore2(hlog.IDFromCtx(ctx)).String())
-				})
-				joinerr.Log(&logger)
-				return
-			}
+			return match.Update(ctx, app, match.WithData(data), match.WithDryRun(dryRun), match.WithRelease(release)), true
 		case "user":
 			payload, err := io.ReadAll(r.Body)
 			// we need to parse the body first before sending a message
 			logger.Info().Bool("dry-run", dryRun).Send()
 			if err != nil {
 				logger.Error().Err(err).Msg("reading data")
-				return
+				return match.Result{}, false
 			}
 			defer r.Body.Close()
 
-			joinerr := user_handler.HandlerUserUpdate(ctx, payload, dryRun)
-
-			if joinerr.IsNotEmpty() {
-				logger := logger.With().Logger()
-				logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-					return c.Str("reqID", utils.Ignore2(hlog.IDFromCtx(ctx)).String())
-				})
-				joinerr.Log(&logger)
-				return
-			}
+			return user_handler.HandlerUserUpdate(ctx, payload, dryRun), true
 		default:
 			http.Error(w, "unsupported: "+ctx.Value(auth.TypeKey).(string), 500)
+			return match.Result{}, false
+		}
+	})
+}
+
+// streamUpdate runs update on the background with his log streamed on the response, ok is false if the update
+// could not run. If the update takes too long the response ends with the address of the log and the update continues
+func streamUpdate(w http.ResponseWriter, r *http.Request, update func(ctx context.Context, logger *zerolog.Logger) (result match.Result, ok bool)) {
+	requestCtx := r.Context()
+	childCtx := context.WithoutCancel(requestCtx)
+	// TODO make this configurable
+	timeout := time.NewTimer(60 * time.Second)
+	taskChan := make(chan struct{}, 0)
+
+	logger, handler := logger.LoggerCtx_FromContext(childCtx)
+
+	go func(ctx context.Context, channel chan<- struct{}) {
+		defer func() {
+			handler.End()
+			channel <- struct{}{}
+		}()
+		joinerr, ok := update(ctx, logger)
+		if !ok {
+			return
+		}
+		if joinerr.IsNotEmpty() {
+			logger := logger.With().Logger()
+			logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+				return c.Str("reqID", utils.Ignore2(hlog.IDFromCtx(ctx)).String())
+			})
+			joinerr.Log(&logger)
 			return
 		}
 
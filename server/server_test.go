@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"hash/crc32"
 	"io"
@@ -16,7 +17,10 @@ import (
 	"testing"
 
 	"github.com/ross96D/updater/server"
+	"github.com/ross96D/updater/server/auth"
 	"github.com/ross96D/updater/share"
+	"github.com/ross96D/updater/share/configuration"
+	"github.com/ross96D/updater/share/match"
 	"github.com/ross96D/updater/share/utils"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
@@ -34,6 +38,7 @@ func TestUpdateEnpoint(t *testing.T) {
 
 	apps: [
 		{
+			name:       "app1"
 			auth_token: "identifier-secret-token"
 
 			assets: [
@@ -276,3 +281,171 @@ func TestParseMultipartForm(t *testing.T) {
 
 	require.Equal(t, string(message), fmt.Sprintf("data:%s", dataHash))
 }
+
+func TestReloadConfigErrors(t *testing.T) {
+	err := share.ReloadString(`
+	port:            7432
+	user_secret_key: "secret_key"
+	user_jwt_expiry: "2h"
+	`)
+	require.NoError(t, err)
+	token, err := auth.NewUserToken("user")
+	require.NoError(t, err)
+
+	reload := func(body string) configuration.ValidationErrors {
+		req := httptest.NewRequest(http.MethodPost, "/reload", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+string(token))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		server.New("", "").TestServeHTTP(w, req)
+
+		res := w.Result()
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+
+		var errs server.ConfigErrors
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&errs))
+		return errs.Errors
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/reload", bytes.NewBufferString("port: \"7432\"\n"))
+	req.Header.Set("Authorization", "Bearer "+string(token))
+	w := httptest.NewRecorder()
+	server.New("", "").TestServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Contains(t, w.Result().Header.Get("Content-Type"), "text/plain")
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/reload", bytes.NewBufferString("port: \"7432\"\n"))
+	req.Header.Set("Authorization", "Bearer "+string(token))
+	w = httptest.NewRecorder()
+	server.New("", "").TestServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Equal(t, "application/json", w.Result().Header.Get("Content-Type"))
+
+	errs := reload("port: \"7432\"\nuser_secret_key: \"secret_key\"\nuser_jwt_expiry: \"2h\"\n")
+	require.Len(t, errs, 1)
+	assert.Equal(t, configuration.KindSchema, errs[0].Kind)
+	assert.Equal(t, "port", errs[0].Path)
+	assert.Equal(t, 1, errs[0].Line)
+
+	errs = reload("port: 7432\nuser_secret_key: \"secret_key\"\nuser_jwt_expiry: \"2h\"\napps: [\n")
+	require.NotEmpty(t, errs)
+	assert.Equal(t, configuration.KindSyntax, errs[0].Kind)
+
+	errs = reload(`
+	port:            7432
+	user_secret_key: "secret_key"
+	user_jwt_expiry: "2h"
+	apps: [{name: "a", assets: [{name: "a", system_path: "/a"}, {name: "a", system_path: "/b"}]}]
+	`)
+	require.Len(t, errs, 1)
+	assert.Equal(t, configuration.KindDuplicateAssetName, errs[0].Kind)
+	assert.Equal(t, "apps.0.assets.1.name", errs[0].Path)
+
+	errs = reload(`
+	port:            7432
+	user_secret_key: "secret_key"
+	user_jwt_expiry: "2h"
+	apps: [{name: "a", assets: []}, {assets: []}, {assets: []}, {name: "a", assets: []}]
+	`)
+	require.Len(t, errs, 1)
+	assert.Equal(t, configuration.KindDuplicateAppName, errs[0].Kind)
+	assert.Equal(t, "apps.3.name", errs[0].Path)
+
+}
+
+func TestCancelUpdateNotFound(t *testing.T) {
+	err := share.ReloadString(`
+	port:            7432
+	user_secret_key: "secret_key"
+	user_jwt_expiry: "2h"
+	`)
+	require.NoError(t, err)
+	token, err := auth.NewUserToken("user")
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/updates/unknown/cancel", nil)
+	req.Header.Set("Authorization", "Bearer "+string(token))
+	w := httptest.NewRecorder()
+	server.New("", "").TestServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+
+	req = httptest.NewRequest(http.MethodGet, "/updates", nil)
+	req.Header.Set("Authorization", "Bearer "+string(token))
+	w = httptest.NewRecorder()
+	server.New("", "").TestServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	var updates []match.UpdateInfo
+	require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&updates))
+}
+
+func TestAPIv1(t *testing.T) {
+	err := share.ReloadString(`
+	port:            7432
+	user_secret_key: "secret_key"
+	user_jwt_expiry: "2h"
+	apps: [
+		{name: "web", auth_token: "web_token", assets: [{name: "web", system_path: "/srv/web"}]},
+		{auth_token: "unnamed_token", assets: []},
+	]
+	`)
+	require.NoError(t, err)
+	token, err := auth.NewUserToken("user")
+	require.NoError(t, err)
+
+	do := func(method, path, authorization string) *http.Response {
+		req := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		server.New("", "").TestServeHTTP(w, req)
+		return w.Result()
+	}
+
+	t.Run("apps", func(t *testing.T) {
+		res := do(http.MethodGet, "/api/v1/apps", "Bearer "+string(token))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var list server.APIAppList
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&list))
+		require.Len(t, list.Apps, 2)
+		assert.Equal(t, "web", list.Apps[0].Name)
+		assert.Equal(t, "", list.Apps[1].Name)
+
+		res = do(http.MethodGet, "/api/v1/apps/web", "Bearer "+string(token))
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var app configuration.Application
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&app))
+		assert.Equal(t, "/srv/web", app.Assets[0].SystemPath)
+
+		res = do(http.MethodGet, "/api/v1/apps/unknown", "Bearer "+string(token))
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		res = do(http.MethodPost, "/api/v1/apps/unknown/update", "Bearer "+string(token))
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("auth", func(t *testing.T) {
+		res := do(http.MethodGet, "/api/v1/apps", "")
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		res = do(http.MethodGet, "/api/v1/apps", "web_token")
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+		res = do(http.MethodPost, "/api/v1/apps/web/update", "web_token")
+		assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("openapi", func(t *testing.T) {
+		res := do(http.MethodGet, "/api/v1/openapi.json", "")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+		var doc struct {
+			OpenAPI string         `json:"openapi"`
+			Paths   map[string]any `json:"paths"`
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&doc))
+		assert.NotEmpty(t, doc.OpenAPI)
+		for _, path := range []string{"/apps", "/apps/{name}", "/apps/{name}/update", "/config", "/reload"} {
+			assert.Contains(t, doc.Paths, path)
+		}
+	})
+}
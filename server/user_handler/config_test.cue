@@ -3,6 +3,7 @@ user_secret_key: ""
 user_jwt_expiry: "2m"
 apps: [
 	{
+		name:       "app1"
 		auth_token: "-"
 		service:    "nothing"
 
@@ -23,6 +24,7 @@ apps: [
 		]
 	},
 	{
+		name:       "app2"
 		auth_token: "-"
 
 		assets: [
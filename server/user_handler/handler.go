@@ -17,11 +17,12 @@ import (
 )
 
 type GithubReleaseData struct {
+	ctx     context.Context
 	client  *github.Client
 	release *github.RepositoryRelease
 }
 
-func NewGithubReleaseData(app configuration.Application) (match.Data, error) {
+func NewGithubReleaseData(ctx context.Context, app configuration.Application) (match.Data, error) {
 	if app.GithubRelease == nil {
 		return nil, errors.New("no github repo configured")
 	}
@@ -31,12 +32,16 @@ func NewGithubReleaseData(app configuration.Application) (match.Data, error) {
 		client = client.WithAuthToken(app.GithubRelease.Token)
 	}
 
-	release, _, err := client.Repositories.GetLatestRelease(context.TODO(), app.GithubRelease.Owner, app.GithubRelease.Repo)
+	release, _, err := client.Repositories.GetLatestRelease(ctx, app.GithubRelease.Owner, app.GithubRelease.Repo)
 	if err != nil {
 		return nil, fmt.Errorf("NewGithubReleaseData GetLatestRelease() %w", err)
 	}
 
-	return GithubReleaseData{client: client, release: release}, nil
+	return GithubReleaseData{ctx: ctx, client: client, release: release}, nil
+}
+
+func (gd GithubReleaseData) Release() match.Release {
+	return match.Release{Tag: gd.release.GetTagName()}
 }
 
 func (gd GithubReleaseData) Clean() {}
@@ -55,7 +60,7 @@ func (gd GithubReleaseData) Get(name string) io.ReadCloser {
 		return nil
 	}
 
-	rc, _, err := downloadableAsset(gd.client, *toDownload.URL)
+	rc, _, err := downloadableAsset(gd.ctx, gd.client, *toDownload.URL)
 	if err != nil {
 		log.Error().Err(err).Msg("error in GithubReleaseData downloadableAsset()")
 		return nil
@@ -63,14 +68,14 @@ func (gd GithubReleaseData) Get(name string) io.ReadCloser {
 	return rc
 }
 
-func downloadableAsset(client *github.Client, url string) (rc io.ReadCloser, lenght int64, err error) {
+func downloadableAsset(ctx context.Context, client *github.Client, url string) (rc io.ReadCloser, lenght int64, err error) {
 	req, err := client.NewRequest(http.MethodGet, url, nil)
 	req.Header.Set("Accept", "application/octet-stream")
 
 	if err != nil {
 		return
 	}
-	resp, err := client.BareDo(context.TODO(), req)
+	resp, err := client.BareDo(ctx, req)
 	if err != nil {
 		return
 	}
@@ -79,7 +84,7 @@ func downloadableAsset(client *github.Client, url string) (rc io.ReadCloser, len
 		return
 	}
 	if resp.ContentLength < 0 {
-		if resp.ContentLength, err = getHeaders(client, url); err != nil {
+		if resp.ContentLength, err = getHeaders(ctx, client, url); err != nil {
 			err = fmt.Errorf("head request: %w", err)
 			return
 		}
@@ -87,13 +92,13 @@ func downloadableAsset(client *github.Client, url string) (rc io.ReadCloser, len
 	return resp.Body, resp.ContentLength, nil
 }
 
-func getHeaders(client *github.Client, url string) (lenght int64, err error) {
+func getHeaders(ctx context.Context, client *github.Client, url string) (lenght int64, err error) {
 	req, err := client.NewRequest(http.MethodHead, url, nil)
 	req.Header.Set("Accept", "application/octet-stream")
 	if err != nil {
 		return
 	}
-	resp, err := client.BareDo(context.TODO(), req)
+	resp, err := client.BareDo(ctx, req)
 	if err != nil {
 		return
 	}
@@ -113,39 +118,46 @@ func GetReleaseRepository(app configuration.Application) (*github.RepositoryRele
 	return client.Repositories.GetLatestRelease(context.TODO(), app.GithubRelease.Owner, app.GithubRelease.Repo)
 }
 
-func HandlerUserUpdate(ctx context.Context, payload []byte, dryRun bool) (errs match.JoinErrors) {
+func HandlerUserUpdate(ctx context.Context, payload []byte, dryRun bool) (result match.Result) {
 	var app App
 	err := json.Unmarshal(payload, &app)
 	if err != nil {
-		errs.Add(fmt.Errorf("HandlerUserUpdate Unmarshall() %w", err))
+		result.Add(fmt.Errorf("HandlerUserUpdate Unmarshall() %w", err))
 		return
 	}
 	log.Info().Interface("user app", app).Send()
 	list := share.Config().Apps
 	if app.Index >= len(list) {
-		errs.Add(errors.New("HandlerUserUpdate invalid index"))
+		result.Add(errors.New("HandlerUserUpdate invalid index"))
 		return
 	}
-	application := list[app.Index]
+	return UpdateApp(ctx, list[app.Index], dryRun)
+}
+
+// UpdateApp updates the application with the assets of the latest release of his github repository
+func UpdateApp(ctx context.Context, application configuration.Application, dryRun bool) (result match.Result) {
 	if application.GithubRelease == nil {
-		errs.Add(errors.New("no github repo configured"))
+		result.Add(errors.New("no github repo configured"))
 		return
 	}
 
+	var err error
 	logger, _ := logger.LoggerCtx_FromContext(ctx)
 	logger.Info().Msgf("Requesting release from github.com/%s/%s ", application.GithubRelease.Owner, application.GithubRelease.Repo)
 	var data match.Data
+	var release match.Release
 	if !dryRun {
-		data, err = NewGithubReleaseData(application)
+		data, err = NewGithubReleaseData(ctx, application)
 		if err != nil {
 			logger.Info().Msg("Requesting release failed")
-			errs.Add(err)
+			result.Add(err)
 			return
 		}
+		release = data.(GithubReleaseData).Release()
 	} else {
 		data = match.EmptyData{}
 	}
-	return match.Update(ctx, application, match.WithData(data), match.WithDryRun(dryRun))
+	return match.Update(ctx, application, match.WithData(data), match.WithDryRun(dryRun), match.WithRelease(release))
 }
 
 type Server struct {
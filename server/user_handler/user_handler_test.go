@@ -33,6 +33,7 @@ func TestHandleUserAppsList(t *testing.T) {
 		{
 			Index: 0,
 			Application: configuration.Application{
+				Name:      "app1",
 				AuthToken: "-",
 				Service:   "nothing",
 				Assets: []configuration.Asset{
@@ -55,6 +56,7 @@ func TestHandleUserAppsList(t *testing.T) {
 		{
 			Index: 1,
 			Application: configuration.Application{
+				Name:      "app2",
 				AuthToken: "-",
 				Assets: []configuration.Asset{
 					{
@@ -4,12 +4,15 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/user"
+	"path/filepath"
 	"slices"
-	"strings"
 
 	"github.com/hmdsefi/gograph"
 	"github.com/ross96D/updater/share/configuration"
+	"github.com/ross96D/updater/share/match"
 	"github.com/ross96D/updater/share/utils"
+	taskservice "github.com/ross96D/updater/task_service"
 	"github.com/rs/zerolog/log"
 )
 
@@ -21,7 +24,12 @@ func ConfigPath() string {
 }
 
 func ReplaceConfigFile(data []byte) error {
-	f, err := os.Create(configPath)
+	return ReplaceConfigFileAt(configPath, data)
+}
+
+// ReplaceConfigFileAt writes data to path, path should be obtained from ConfigFilePath
+func ReplaceConfigFileAt(path string, data []byte) error {
+	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
@@ -30,6 +38,49 @@ func ReplaceConfigFile(data []byte) error {
 	return err
 }
 
+// ConfigFilePath resolves the name of a configuration file relative to the directory of the main
+// configuration file. An empty name is the main configuration file, any other name must be
+// a file inside the include directory
+func ConfigFilePath(name string) (string, error) {
+	if name == "" {
+		return configPath, nil
+	}
+	path := filepath.Join(filepath.Dir(configPath), filepath.FromSlash(name))
+	if path == filepath.Clean(configPath) {
+		return path, nil
+	}
+	includeDir := configuration.IncludeDir(config, configPath)
+	if includeDir == "" {
+		return "", fmt.Errorf("invalid config file %s: the configuration does not have an include directory", name)
+	}
+	if filepath.Dir(path) != includeDir || !configuration.IsConfigFile(path) {
+		return "", fmt.Errorf("invalid config file %s: must be a .cue, .yaml or .json file inside %s", name, config.Include)
+	}
+	return path, nil
+}
+
+// ConfigFiles returns the name of all the files that compose the configuration,
+// the main configuration file goes first
+func ConfigFiles() ([]string, error) {
+	files := []string{filepath.Base(configPath)}
+	includeDir := configuration.IncludeDir(config, configPath)
+	if includeDir == "" {
+		return files, nil
+	}
+	included, err := configuration.IncludeFiles(includeDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range included {
+		name, err := filepath.Rel(filepath.Dir(configPath), path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, filepath.ToSlash(name))
+	}
+	return files, nil
+}
+
 var DefaultPath string = "nothing for now"
 
 var ErrNoChecksum = errors.New("no checksum")
@@ -40,7 +91,7 @@ func Init(path string) error {
 		return err
 	}
 
-	if err = changeConfig(newConfig); err != nil {
+	if err = changeConfig(newConfig, path); err != nil {
 		return err
 	}
 	configPath = path
@@ -54,123 +105,192 @@ func MustInit(path string) {
 	}
 }
 
-func changeConfig(newConfig configuration.Configuration) (err error) {
+// changeConfig validates and sets the new configuration, path is the one of the main configuration file
+func changeConfig(newConfig configuration.Configuration, path string) (err error) {
 	if newConfig.BasePath == "" {
 		newConfig.BasePath = DefaultPath
 	}
-	if invalidPaths := ConfigPathValidation(newConfig); len(invalidPaths) != 0 {
-		err = fmt.Errorf("invalid paths:\n%s", strings.Join(invalidPaths, "\n"))
-		return
+	if errs := ConfigPathValidation(newConfig); len(errs) != 0 {
+		return errs
 	}
 
-	if invalidNames := ConfigAssetsNameUniquenessValidation(newConfig); invalidNames != nil {
-		errMsg := strings.Builder{}
-		for k, v := range invalidNames {
-			errMsg.WriteString("invalid assets name for " + k + " duplicated names: ")
-			errMsg.WriteString(strings.Join(v, " "))
-			errMsg.WriteByte('\n')
-		}
-		err = errors.New(errMsg.String())
-		return
+	if errs := ConfigAppsNameUniquenessValidation(newConfig); len(errs) != 0 {
+		return errs
 	}
 
-	if invalidNames := ConfigAssetsDependencyValidation(newConfig); invalidNames != nil {
-		errMsg := strings.Builder{}
-		for k, v := range invalidNames {
-			errMsg.WriteString("invalid asset dependency for " + k + " assets could not be found: ")
-			errMsg.WriteString(strings.Join(v, " "))
-			errMsg.WriteByte('\n')
-		}
-		err = errors.New(errMsg.String())
-		return
+	if errs := ConfigAppsCronFileNameValidation(newConfig); len(errs) != 0 {
+		return errs
+	}
+
+	if errs := ConfigAssetsNameUniquenessValidation(newConfig); len(errs) != 0 {
+		return errs
+	}
+
+	if errs := ConfigAssetsDependencyValidation(newConfig); len(errs) != 0 {
+		return errs
+	}
+
+	if errs := ConfigDependencyCyclicValidation(newConfig); len(errs) != 0 {
+		return errs
+	}
+
+	if errs := ConfigCommandValidation(newConfig); len(errs) != 0 {
+		return errs
 	}
 
-	if cyclicErr := ConfigDependencyCyclicValidation(newConfig); cyclicErr != nil {
-		return cyclicErr
+	if errs := ConfigCommandIdentityValidation(newConfig); len(errs) != 0 {
+		return errs
+	}
+	if errs := ConfigBlueGreenValidation(newConfig); len(errs) != 0 {
+		return errs
+	}
+	if errs := ConfigServicesValidation(newConfig); len(errs) != 0 {
+		return errs
+	}
+	if errs := ConfigServiceScopeValidation(newConfig); len(errs) != 0 {
+		return errs
+	}
+	if errs := ConfigContainerValidation(newConfig); len(errs) != 0 {
+		return errs
+	}
+	if errs := configureCronBackend(newConfig, path); len(errs) != 0 {
+		return errs
 	}
 	ConfigSetAssetOrder(&newConfig)
 
 	config = newConfig
 	log.Info().Interface("configuration", config).Send()
+
+	apps := make([]string, 0, len(config.Apps))
+	for _, app := range config.Apps {
+		apps = append(apps, app.Name)
+	}
+	if err := match.CleanupCronJobs(&log.Logger, apps); err != nil {
+		log.Error().Err(err).Msg("removing the cron jobs of deleted apps")
+	}
 	return
 }
 
-func ConfigPathValidation(config configuration.Configuration) (invalidPaths []string) {
-	var isCorrect bool
-	invalidPaths = make([]string, 0)
-	if isCorrect = utils.ValidPath(config.BasePath); !isCorrect {
-		invalidPaths = append(invalidPaths, config.BasePath)
+func ConfigPathValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	errs = configuration.ValidationErrors{}
+	if !utils.ValidPath(config.BasePath) {
+		errs = append(errs, configuration.ValidationError{
+			Path:    "base_path",
+			Kind:    configuration.KindInvalidPath,
+			Message: "invalid path " + config.BasePath,
+		})
 	}
-	for _, app := range config.Apps {
-		for _, asset := range app.Assets {
-			if isCorrect = utils.ValidPath(asset.SystemPath); !isCorrect {
-				invalidPaths = append(invalidPaths, asset.SystemPath)
+	for i, app := range config.Apps {
+		for j, asset := range app.Assets {
+			if !utils.ValidPath(asset.SystemPath) {
+				errs = append(errs, configuration.ValidationError{
+					Path:    fmt.Sprintf("apps.%d.assets.%d.system_path", i, j),
+					Kind:    configuration.KindInvalidPath,
+					Message: "invalid path " + asset.SystemPath,
+				})
 			}
 		}
 	}
 	return
 }
 
-func ConfigAssetsNameUniquenessValidation(config configuration.Configuration) (invalidNames map[string][]string) {
-	invalidNames = nil
-	for _, app := range config.Apps {
+// ConfigAppsNameUniquenessValidation checks that the names of the apps are unique, the apps are addressed by
+// name on the api. Apps without name are not checked
+func ConfigAppsNameUniquenessValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	names := make([]string, 0, len(config.Apps))
+	for i, app := range config.Apps {
+		if app.Name == "" {
+			continue
+		}
+		if slices.Contains(names, app.Name) {
+			errs = append(errs, configuration.ValidationError{
+				Path:    fmt.Sprintf("apps.%d.name", i),
+				Kind:    configuration.KindDuplicateAppName,
+				Message: fmt.Sprintf("duplicated app name: %s", app.Name),
+			})
+		} else {
+			names = append(names, app.Name)
+		}
+	}
+	return errs
+}
+
+// ConfigAppsCronFileNameValidation checks that the names of the apps map to different cron files,
+// the jobs of an app would replace the ones of the other
+func ConfigAppsCronFileNameValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	owners := make(map[string]string, len(config.Apps))
+	for i, app := range config.Apps {
+		name, err := match.CronFileName(app.Name)
+		if err != nil {
+			continue
+		}
+		if owner, ok := owners[name]; ok && owner != app.Name {
+			errs = append(errs, configuration.ValidationError{
+				Path:    fmt.Sprintf("apps.%d.name", i),
+				Kind:    configuration.KindDuplicateAppName,
+				Message: fmt.Sprintf("the app name %s has the same cron file name %s of the app %s", app.Name, name, owner),
+			})
+		} else {
+			owners[name] = app.Name
+		}
+	}
+	return errs
+}
+
+func ConfigAssetsNameUniquenessValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	for i, app := range config.Apps {
 		names := make([]string, 0, len(app.Assets))
-		for _, asset := range app.Assets {
+		for j, asset := range app.Assets {
 			if slices.Contains(names, asset.Name) {
-				if invalidNames == nil {
-					invalidNames = make(map[string][]string)
-				}
-				if invalidNames[app.Name] == nil {
-					invalidNames[app.Name] = make([]string, 0)
-				}
-				invalidNames[app.Name] = append(invalidNames[app.Name], asset.Name)
+				errs = append(errs, configuration.ValidationError{
+					Path:    fmt.Sprintf("apps.%d.assets.%d.name", i, j),
+					Kind:    configuration.KindDuplicateAssetName,
+					Message: fmt.Sprintf("invalid assets name for %s duplicated name: %s", app.Name, asset.Name),
+				})
 			} else {
 				names = append(names, asset.Name)
 			}
 		}
 	}
-	return invalidNames
+	return errs
 }
 
-func ConfigAssetsDependencyValidation(config configuration.Configuration) (invalidNames map[string][]string) {
-	invalidNames = nil
-
-	fnCheck := func(app configuration.Application, str string) {
-		if !slices.ContainsFunc(app.Assets, func(asset configuration.Asset) bool {
-			return asset.Name == str
-		}) {
-			if invalidNames == nil {
-				invalidNames = make(map[string][]string)
-			}
-			if invalidNames[app.Name] == nil {
-				invalidNames[app.Name] = make([]string, 0)
+func ConfigAssetsDependencyValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	for i, app := range config.Apps {
+		fnCheck := func(key string, str string) {
+			if !slices.ContainsFunc(app.Assets, func(asset configuration.Asset) bool {
+				return asset.Name == str
+			}) {
+				errs = append(errs, configuration.ValidationError{
+					Path:    fmt.Sprintf("apps.%d.assets_dependency.%s", i, key),
+					Kind:    configuration.KindMissingDependency,
+					Message: fmt.Sprintf("invalid asset dependency for %s asset could not be found: %s", app.Name, str),
+				})
 			}
-			invalidNames[app.Name] = append(invalidNames[app.Name], str)
 		}
-	}
-	for _, app := range config.Apps {
 		for key, deps := range app.AssetsDependency {
-			fnCheck(app, key)
+			fnCheck(key, key)
 			for _, dep := range deps {
-				fnCheck(app, dep)
+				fnCheck(key, dep)
 			}
 		}
 	}
-	return invalidNames
+	return errs
 }
 
-func ConfigDependencyCyclicValidation(config configuration.Configuration) error {
-	for _, app := range config.Apps {
+func ConfigDependencyCyclicValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	for i, app := range config.Apps {
 		graph := gograph.New[string](gograph.Acyclic())
-		firstKey := ""
 		for key, deps := range app.AssetsDependency {
-			if firstKey == "" {
-				firstKey = key
-			}
 			for _, dep := range deps {
 				_, err := graph.AddEdge(gograph.NewVertex(key), gograph.NewVertex(dep))
 				if err != nil {
-					return fmt.Errorf("%w: on app %s and dependency key %s value %s", err, app.Name, key, dep)
+					errs = append(errs, configuration.ValidationError{
+						Path:    fmt.Sprintf("apps.%d.assets_dependency.%s", i, key),
+						Kind:    configuration.KindDependencyCycle,
+						Message: fmt.Sprintf("%s: on app %s and dependency key %s value %s", err, app.Name, key, dep),
+					})
+					return errs
 				}
 			}
 		}
@@ -178,6 +298,225 @@ func ConfigDependencyCyclicValidation(config configuration.Configuration) error
 	return nil
 }
 
+// commands calls fn for every command of the configuration with the path of the command
+func commands(config configuration.Configuration, fn func(path string, command configuration.Command)) {
+	for i, app := range config.Apps {
+		if app.CommandPre != nil {
+			fn(fmt.Sprintf("apps.%d.cmd_pre", i), *app.CommandPre)
+		}
+		if app.Command != nil {
+			fn(fmt.Sprintf("apps.%d.cmd", i), *app.Command)
+		}
+		if app.BlueGreen != nil {
+			if app.BlueGreen.HealthCheck != nil {
+				fn(fmt.Sprintf("apps.%d.blue_green.health_check", i), *app.BlueGreen.HealthCheck)
+			}
+			if app.BlueGreen.Switch != nil {
+				fn(fmt.Sprintf("apps.%d.blue_green.switch", i), *app.BlueGreen.Switch)
+			}
+		}
+		for j, asset := range app.Assets {
+			if asset.CommandPre != nil {
+				fn(fmt.Sprintf("apps.%d.assets.%d.cmd_pre", i, j), *asset.CommandPre)
+			}
+			if asset.Command != nil {
+				fn(fmt.Sprintf("apps.%d.assets.%d.cmd", i, j), *asset.Command)
+			}
+		}
+	}
+}
+
+func ConfigCommandValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	commands(config, func(path string, command configuration.Command) {
+		if (command.Command == "") == (command.Script == "") {
+			errs = append(errs, configuration.ValidationError{
+				Path:    path,
+				Kind:    configuration.KindInvalidCommand,
+				Message: "exactly one of command or script must be set",
+			})
+		}
+	})
+	return errs
+}
+
+func ConfigCommandIdentityValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	commands(config, func(path string, command configuration.Command) {
+		if command.User != "" {
+			if _, err := user.Lookup(command.User); err != nil {
+				errs = append(errs, configuration.ValidationError{
+					Path:    path + ".user",
+					Kind:    configuration.KindUnknownUser,
+					Message: err.Error(),
+				})
+			}
+		}
+		if command.Group != "" {
+			if _, err := user.LookupGroup(command.Group); err != nil {
+				errs = append(errs, configuration.ValidationError{
+					Path:    path + ".group",
+					Kind:    configuration.KindUnknownUser,
+					Message: err.Error(),
+				})
+			}
+		}
+	})
+	return errs
+}
+
+// ConfigServicesValidation checks that an app sets only one of service and services
+// and that the names of the services are unique
+func ConfigServicesValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	for i, app := range config.Apps {
+		if app.Service != "" && len(app.Services) != 0 {
+			errs = append(errs, configuration.ValidationError{
+				Path:    fmt.Sprintf("apps.%d.services", i),
+				Kind:    configuration.KindSchema,
+				Message: "only one of service and services can be set",
+			})
+		}
+		names := make(map[string]bool, len(app.Services))
+		for j, service := range app.Services {
+			if names[service.Name] {
+				errs = append(errs, configuration.ValidationError{
+					Path:    fmt.Sprintf("apps.%d.services.%d.name", i, j),
+					Kind:    configuration.KindSchema,
+					Message: fmt.Sprintf("duplicated service %s", service.Name),
+				})
+			}
+			names[service.Name] = true
+		}
+	}
+	return errs
+}
+
+// ConfigBlueGreenValidation checks that the release directory of the blue/green apps is absolute and that
+// their assets have paths relative to it and no service, the instances are the services
+func ConfigBlueGreenValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	for i, app := range config.Apps {
+		if app.BlueGreen == nil {
+			continue
+		}
+		if !filepath.IsAbs(app.BlueGreen.ReleaseDir) {
+			errs = append(errs, configuration.ValidationError{
+				Path:    fmt.Sprintf("apps.%d.blue_green.release_dir", i),
+				Kind:    configuration.KindInvalidPath,
+				Message: "the release directory must be an absolute path",
+			})
+		}
+		for j, asset := range app.Assets {
+			if !filepath.IsLocal(asset.SystemPath) {
+				errs = append(errs, configuration.ValidationError{
+					Path:    fmt.Sprintf("apps.%d.assets.%d.system_path", i, j),
+					Kind:    configuration.KindInvalidPath,
+					Message: "the assets of a blue/green app must have a path relative to the release directory",
+				})
+			}
+			if asset.Service != "" {
+				errs = append(errs, configuration.ValidationError{
+					Path:    fmt.Sprintf("apps.%d.assets.%d.service", i, j),
+					Kind:    configuration.KindSchema,
+					Message: "the assets of a blue/green app can not have a service",
+				})
+			}
+		}
+	}
+	return errs
+}
+
+// ConfigServiceScopeValidation checks that the user scope is only used by systemd services and that
+// the owners of the user services exist
+func ConfigServiceScopeValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	// prefix is the prefix of the fields, service_ on apps and assets
+	check := func(path string, prefix string, serviceType string, scope string, serviceUser string) {
+		if scope == string(taskservice.ScopeUser) && taskservice.ServiceTypeFrom(serviceType) != taskservice.Systemctl {
+			errs = append(errs, configuration.ValidationError{
+				Path:    path + "." + prefix + "scope",
+				Kind:    configuration.KindSchema,
+				Message: "the user scope is only used by the systemd services",
+			})
+		}
+		if serviceUser == "" {
+			return
+		}
+		if scope != string(taskservice.ScopeUser) {
+			errs = append(errs, configuration.ValidationError{
+				Path:    path + "." + prefix + "user",
+				Kind:    configuration.KindSchema,
+				Message: "the user is only used by the services of the user scope",
+			})
+		} else if _, err := user.Lookup(serviceUser); err != nil {
+			errs = append(errs, configuration.ValidationError{
+				Path:    path + "." + prefix + "user",
+				Kind:    configuration.KindUnknownUser,
+				Message: err.Error(),
+			})
+		}
+	}
+	for i, app := range config.Apps {
+		check(fmt.Sprintf("apps.%d", i), "service_", app.ServiceType, app.ServiceScope, app.ServiceUser)
+		for j, service := range app.Services {
+			check(fmt.Sprintf("apps.%d.services.%d", i, j), "", service.Type, service.Scope, service.User)
+		}
+		if bg := app.BlueGreen; bg != nil {
+			check(fmt.Sprintf("apps.%d.blue_green", i), "", bg.Type, bg.Scope, bg.User)
+		}
+		for j, asset := range app.Assets {
+			check(fmt.Sprintf("apps.%d.assets.%d", i, j), "service_", asset.ServiceType, asset.ServiceScope, asset.ServiceUser)
+		}
+	}
+	return errs
+}
+
+// ConfigContainerValidation checks that the services of type container have a name and a container,
+// and that the container field is only set on them
+func ConfigContainerValidation(config configuration.Configuration) (errs configuration.ValidationErrors) {
+	// nameField is the field with the name of the container
+	check := func(path string, nameField string, service string, serviceType string, container *configuration.Container) {
+		switch {
+		case serviceType == "container" && container == nil:
+			errs = append(errs, configuration.ValidationError{
+				Path:    path + ".container",
+				Kind:    configuration.KindInvalidContainer,
+				Message: "a service of type container needs the container field",
+			})
+		case serviceType == "container" && service == "":
+			errs = append(errs, configuration.ValidationError{
+				Path:    path + "." + nameField,
+				Kind:    configuration.KindInvalidContainer,
+				Message: fmt.Sprintf("a service of type container needs the %s field, the container name", nameField),
+			})
+		case serviceType != "container" && container != nil:
+			errs = append(errs, configuration.ValidationError{
+				Path:    path + ".container",
+				Kind:    configuration.KindInvalidContainer,
+				Message: "container is only used by the services of type container",
+			})
+		}
+	}
+	appLoad := func(path string, container *configuration.Container) {
+		if container != nil && container.Load {
+			errs = append(errs, configuration.ValidationError{
+				Path:    path + ".container.load",
+				Kind:    configuration.KindInvalidContainer,
+				Message: "load is only used by the containers of the assets",
+			})
+		}
+	}
+	for i, app := range config.Apps {
+		check(fmt.Sprintf("apps.%d", i), "service", app.Service, app.ServiceType, app.Container)
+		appLoad(fmt.Sprintf("apps.%d", i), app.Container)
+		for j, service := range app.Services {
+			path := fmt.Sprintf("apps.%d.services.%d", i, j)
+			check(path, "name", service.Name, service.Type, service.Container)
+			appLoad(path, service.Container)
+		}
+		for j, asset := range app.Assets {
+			check(fmt.Sprintf("apps.%d.assets.%d", i, j), "service", asset.Service, asset.ServiceType, asset.Container)
+		}
+	}
+	return errs
+}
+
 type asset struct {
 	asset   configuration.AssetOrder
 	visited bool
@@ -235,12 +574,24 @@ func ConfigSetAssetOrder(config *configuration.Configuration) {
 }
 
 func ReloadString(data string) error {
+	if configPath != "" {
+		return ReloadFile(configPath, []byte(data))
+	}
 	// TODO aparently this have a bug that sometime miss a field while reading the string
 	newConfig, err := configuration.LoadString(data)
 	if err != nil {
 		return err
 	}
-	return changeConfig(newConfig)
+	return changeConfig(newConfig, configPath)
+}
+
+// ReloadFile reloads the configuration using data as the content of the configuration file at path
+func ReloadFile(path string, data []byte) error {
+	newConfig, err := configuration.LoadOverlay(configPath, configuration.Overlay{path: data})
+	if err != nil {
+		return err
+	}
+	return changeConfig(newConfig, configPath)
 }
 
 func ReadConfigFile() ([]byte, error) {
@@ -253,7 +604,74 @@ func Reload(path string) error {
 		return err
 	}
 
-	return changeConfig(newConfig)
+	return changeConfig(newConfig, path)
+}
+
+type cronBackendConfig struct {
+	backend string
+	dir     string
+}
+
+var currentCronBackend = cronBackendConfig{backend: match.CronBackendCronD, dir: match.DefaultCronDir}
+
+// CronDir returns the directory of the cron backend of the configuration
+func CronDir(config configuration.Configuration, configPath string) string {
+	dir := config.CronDir
+	if dir == "" {
+		switch config.CronBackend {
+		case match.CronBackendBuiltin:
+			dir = "jobs"
+		case match.CronBackendSystemd:
+			dir = match.DefaultSystemdUnitDir
+		default:
+			dir = match.DefaultCronDir
+		}
+	}
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(filepath.Dir(configPath), dir)
+}
+
+// configureCronBackend replaces the cron backend when the configuration changes it
+func configureCronBackend(config configuration.Configuration, configPath string) (errs configuration.ValidationErrors) {
+	next := cronBackendConfig{backend: config.CronBackend, dir: CronDir(config, configPath)}
+	if next.backend == "" {
+		next.backend = match.CronBackendCronD
+	}
+	if next == currentCronBackend {
+		return nil
+	}
+
+	var backend match.CronBackend
+	switch next.backend {
+	case match.CronBackendBuiltin:
+		scheduler, err := match.NewScheduler(next.dir)
+		if err != nil {
+			errs = append(errs, configuration.ValidationError{
+				Path:    "cron_dir",
+				Kind:    configuration.KindInvalidPath,
+				Message: err.Error(),
+			})
+			return errs
+		}
+		backend = scheduler
+	case match.CronBackendSystemd:
+		backend = match.SystemdTimers{Dir: next.dir}
+	default:
+		backend = match.CronD{Dir: next.dir}
+	}
+	log.Info().Str("backend", next.backend).Str("dir", next.dir).Msg("cron backend")
+	apps := make([]string, 0, len(config.Apps))
+	for _, app := range config.Apps {
+		apps = append(apps, app.Name)
+	}
+	if err := match.MigrateCronJobs(&log.Logger, match.CurrentCronBackend(), backend, apps); err != nil {
+		log.Error().Err(err).Msg("moving the cron jobs to the new cron backend")
+	}
+	match.SetCronBackend(backend)
+	currentCronBackend = next
+	return nil
 }
 
 func Config() configuration.Configuration {
@@ -3,6 +3,7 @@ user_secret_key: "some_key"
 user_jwt_expiry: "2h"
 apps: [
 	{
+		name:       "app1"
 		auth_token: "auth"
 
 		assets: [
@@ -13,6 +13,20 @@ type Application struct {
 
 	ServiceType string `json:"service_type"`
 
+	ServiceScope string `json:"service_scope"`
+
+	ServiceUser string `json:"service_user"`
+
+	ServiceAction string `json:"service_action"`
+
+	StartTimeout *Duration `json:"start_timeout"`
+
+	Container *Container `json:"container"`
+
+	Services []Service `json:"services"`
+
+	BlueGreen *BlueGreen `json:"blue_green"`
+
 	Assets []Asset `json:"assets"`
 
 	AsstesOrder []AssetOrder
@@ -24,6 +38,72 @@ type Application struct {
 	Command *Command `json:"cmd"`
 
 	GithubRelease *GithubRelease `json:"github_release"`
+
+	Cron *Cron `json:"cron"`
+}
+
+// Service is an app level service. The services of an app are stopped in order before the assets
+// are updated and started in reverse order after
+type Service struct {
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	Scope        string     `json:"scope"`
+	User         string     `json:"user"`
+	Action       string     `json:"action"`
+	StartTimeout *Duration  `json:"start_timeout"`
+	Container    *Container `json:"container"`
+}
+
+// AppServices returns the app level services in stop order. The service field is a list of one service
+func (app Application) AppServices() []Service {
+	if app.Service == "" {
+		return app.Services
+	}
+	return []Service{{
+		Name:         app.Service,
+		Type:         app.ServiceType,
+		Scope:        app.ServiceScope,
+		User:         app.ServiceUser,
+		Action:       app.ServiceAction,
+		StartTimeout: app.StartTimeout,
+		Container:    app.Container,
+	}}
+}
+
+// BlueGreen deploys an app to two instances of a service, blue and green, each one with his release directory.
+// An update is deployed to the idle color, and when it is healthy the traffic is switched to it
+type BlueGreen struct {
+	// template unit of the instances, like app@.service for app@blue.service and app@green.service
+	Service      string    `json:"service"`
+	Type         string    `json:"type"`
+	Scope        string    `json:"scope"`
+	User         string    `json:"user"`
+	StartTimeout *Duration `json:"start_timeout"`
+	// the release directory of a color is ReleaseDir/<color>, the assets system paths are relative to it
+	ReleaseDir  string   `json:"release_dir"`
+	HealthCheck *Command `json:"health_check"`
+	// command that sends the traffic to the color {{.Color}}
+	Switch *Command `json:"switch"`
+}
+
+// Cron are the defaults of the cron jobs deployed with the __jobs asset
+type Cron struct {
+	User   string            `json:"user"`
+	Env    map[string]string `json:"env"`
+	MailTo *string           `json:"mailto"`
+}
+
+// Container is the container run by the services of type container, named as the service
+type Container struct {
+	// docker or podman, detected if empty
+	Runtime string            `json:"runtime"`
+	Image   string            `json:"image"`
+	Ports   []string          `json:"ports"`
+	Volumes []string          `json:"volumes"`
+	Env     map[string]string `json:"env"`
+	Args    []string          `json:"args"`
+	// the asset is a docker save tarball with the image, instead of pulling it
+	Load bool `json:"load"`
 }
 
 type GithubRelease struct {
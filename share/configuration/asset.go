@@ -1,16 +1,30 @@
 package configuration
 
 type Asset struct {
-	Name        string   `json:"name"`
-	SystemPath  string   `json:"system_path"`
-	Service     string   `json:"service"`
-	ServiceType string   `json:"service_type"`
-	KeepOld     bool     `json:"keep_old"`
-	Unzip       bool     `json:"unzip"`
-	CommandPre  *Command `json:"cmd_pre"`
-	Command     *Command `json:"cmd"`
+	Name          string     `json:"name"`
+	SystemPath    string     `json:"system_path"`
+	Service       string     `json:"service"`
+	ServiceType   string     `json:"service_type"`
+	ServiceScope  string     `json:"service_scope"`
+	ServiceUser   string     `json:"service_user"`
+	ServiceAction string     `json:"service_action"`
+	StartTimeout  *Duration  `json:"start_timeout"`
+	Container     *Container `json:"container"`
+	UnitFile      bool       `json:"unit_file"`
+	KeepOld       bool       `json:"keep_old"`
+	Unzip         bool       `json:"unzip"`
+	CommandPre    *Command   `json:"cmd_pre"`
+	Command       *Command   `json:"cmd"`
 }
 
+// values of service_action, empty is ServiceActionStopStart
+const (
+	ServiceActionStopStart = "stop-start"
+	ServiceActionRestart   = "restart"
+	ServiceActionReload    = "reload"
+	ServiceActionNone      = "none"
+)
+
 type AssetOrder struct {
 	Asset
 	Independent bool
@@ -3,6 +3,7 @@ package configuration
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -14,6 +15,9 @@ type Configuration struct {
 	Apps          []Application `json:"apps"`
 	Users         []User        `json:"users"`
 	BasePath      string        `json:"base_path"`
+	Include       string        `json:"include"`
+	CronBackend   string        `json:"cron_backend"`
+	CronDir       string        `json:"cron_dir"`
 }
 
 func (c Configuration) FindApp(token string) (Application, error) {
@@ -25,6 +29,15 @@ func (c Configuration) FindApp(token string) (Application, error) {
 	return Application{}, errors.New("application not found")
 }
 
+func (c Configuration) FindAppByName(name string) (Application, error) {
+	for _, app := range c.Apps {
+		if app.Name == name {
+			return app, nil
+		}
+	}
+	return Application{}, errors.New("application not found")
+}
+
 type Duration time.Duration
 
 func (d *Duration) UnmarshalJSON(data []byte) error {
@@ -54,11 +67,110 @@ type User struct {
 	Password string `json:"password"`
 }
 
+const DefaultInterpreter = "bash"
+
 type Command struct {
-	Command string            `json:"command"`
-	Args    []string          `json:"args"`
-	Path    string            `json:"path"`
-	Env     map[string]string `json:"env"`
+	Command     string `json:"command"`
+	Script      string `json:"script"`
+	Interpreter string `json:"interpreter"`
+	Strict      *bool  `json:"strict"`
+
+	Args       []string          `json:"args"`
+	Path       string            `json:"path"`
+	Env        map[string]string `json:"env"`
+	EnvFile    StringList        `json:"env_file"`
+	InheritEnv InheritEnv        `json:"inherit_env"`
+	Timeout    Duration          `json:"timeout"`
+	KillGrace  Duration          `json:"kill_grace"`
+	User       string            `json:"user"`
+	Group      string            `json:"group"`
+	Umask      string            `json:"umask"`
+	Limits     *Limits           `json:"limits"`
+
+	AllowedExitCodes []int    `json:"allowed_exit_codes"`
+	OnFailure        string   `json:"on_failure"`
+	Retries          uint     `json:"retries"`
+	RetryBackoff     Duration `json:"retry_backoff"`
+}
+
+// StringList is a list of strings that can be written on the configuration as a single string
+type StringList []string
+
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = StringList{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// InheritEnv are the names of the updater enviroment variables passed to a command.
+// nil means all the variables and an empty list none of them
+type InheritEnv []string
+
+const (
+	InheritEnvAll  = "all"
+	InheritEnvNone = "none"
+)
+
+func (e *InheritEnv) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		switch s {
+		case InheritEnvAll:
+			*e = nil
+		case InheritEnvNone:
+			*e = InheritEnv{}
+		default:
+			return fmt.Errorf("invalid inherit_env %q", s)
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	if list == nil {
+		list = []string{}
+	}
+	*e = list
+	return nil
+}
+
+func (e InheritEnv) MarshalJSON() ([]byte, error) {
+	if e == nil {
+		return json.Marshal(InheritEnvAll)
+	}
+	if len(e) == 0 {
+		return json.Marshal(InheritEnvNone)
+	}
+	return json.Marshal([]string(e))
+}
+
+// Limits are the resource limits of a command, a zero value means no limit
+type Limits struct {
+	CPU          uint64 `json:"cpu"`           // cpu time in seconds
+	AddressSpace uint64 `json:"address_space"` // virtual memory in bytes
+	OpenFiles    uint64 `json:"open_files"`    // number of open file descriptors
+}
+
+func (c Command) InterpreterOrDefault() string {
+	if c.Interpreter == "" {
+		return DefaultInterpreter
+	}
+	return c.Interpreter
 }
 
 func (c Command) String() string {
@@ -66,7 +178,11 @@ func (c Command) String() string {
 	if c.Path != "" {
 		builder.WriteString(c.Path + ": ")
 	}
-	builder.WriteString(c.Command + " ")
+	if c.Script != "" {
+		builder.WriteString(c.InterpreterOrDefault() + " <script> ")
+	} else {
+		builder.WriteString(c.Command + " ")
+	}
 	builder.WriteString(strings.Join(c.Args, " "))
 	return builder.String()
 }
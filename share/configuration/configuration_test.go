@@ -2,6 +2,9 @@ package configuration_test
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/ross96D/updater/share/configuration"
@@ -78,3 +81,141 @@ func TestConfigurationJson(t *testing.T) {
 		assert.Equal(t, conf, actual)
 	}
 }
+
+func TestLoadInclude(t *testing.T) {
+	dir := t.TempDir()
+	main := `
+port:            1234
+user_secret_key: "key"
+user_jwt_expiry: "2m"
+include:         "conf.d"
+apps: [
+	{
+		name: "main"
+		assets: [{name: "asset", system_path: "/main/path"}]
+	},
+]
+`
+	app1 := `
+apps: [
+	{
+		name: "app1"
+		assets: [{name: "asset", system_path: "/app1/path"}]
+	},
+]
+`
+	app2 := `
+apps: [
+	{
+		name: "app2"
+		assets: [{name: "asset", system_path: "/app2/path"}]
+	},
+]
+`
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "conf.d"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.cue"), []byte(main), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d", "app1.cue"), []byte(app1), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d", "app2.cue"), []byte(app2), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d", "ignored.txt"), []byte("invalid"), 0644))
+
+	config, err := configuration.Load(filepath.Join(dir, "config.cue"))
+	require.NoError(t, err)
+	names := []string{}
+	for _, app := range config.Apps {
+		names = append(names, app.Name)
+	}
+	assert.Equal(t, []string{"main", "app1", "app2"}, names)
+	assert.False(t, config.Apps[1].Assets[0].KeepOld)
+
+	invalid := "apps: [\n\t{\n\t\tassets: [{name: \"asset\", system_path: 1}]\n\t\tname:   \"app2\"\n\t},\n]\n"
+	invalidPath := filepath.Join(dir, "conf.d", "app2.cue")
+	_, err = configuration.LoadOverlay(filepath.Join(dir, "config.cue"), configuration.Overlay{invalidPath: []byte(invalid)})
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), invalidPath+":3:"), err.Error())
+
+	newPath := filepath.Join(dir, "conf.d", "app3.cue")
+	config, err = configuration.LoadOverlay(filepath.Join(dir, "config.cue"), configuration.Overlay{newPath: []byte(`apps: []`)})
+	require.NoError(t, err)
+	assert.Len(t, config.Apps, 3)
+
+	_, err = configuration.LoadOverlay(filepath.Join(dir, "config.cue"), configuration.Overlay{newPath: []byte(`port: 1`)})
+	require.Error(t, err)
+}
+
+func TestLoadStringErrorPosition(t *testing.T) {
+	_, err := configuration.LoadString("port: \"invalid\"\nuser_secret_key: \"\"\nuser_jwt_expiry: \"2m\"\n")
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "1:"), err.Error())
+}
+
+func TestLoadFormats(t *testing.T) {
+	dir := t.TempDir()
+	yamlConfig := `
+port: 1234
+user_secret_key: key
+user_jwt_expiry: 2m
+include: conf.d
+apps:
+  - name: yaml
+    assets:
+      - name: asset
+        system_path: /yaml/path
+`
+	jsonApp := `{
+	"apps": [
+		{"name": "json", "assets": [{"name": "asset", "system_path": "/json/path", "keep_old": true}]}
+	]
+}`
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "conf.d"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(yamlConfig), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d", "app.json"), []byte(jsonApp), 0644))
+
+	config, err := configuration.Load(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	require.Len(t, config.Apps, 2)
+	assert.Equal(t, "yaml", config.Apps[0].Name)
+	assert.False(t, config.Apps[0].Assets[0].Unzip)
+	assert.Equal(t, "json", config.Apps[1].Name)
+	assert.True(t, config.Apps[1].Assets[0].KeepOld)
+
+	// the schema constraints apply to yaml too
+	_, err = configuration.LoadOverlay(filepath.Join(dir, "config.yaml"), configuration.Overlay{
+		filepath.Join(dir, "config.yaml"): []byte("port: -1\nuser_secret_key: key\nuser_jwt_expiry: 2m\n"),
+	})
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), filepath.Join(dir, "config.yaml")+":1:"), err.Error())
+
+	_, err = configuration.LoadOverlay(filepath.Join(dir, "config.yaml"), configuration.Overlay{
+		filepath.Join(dir, "conf.d", "app.json"): []byte(`{"apps": [`),
+	})
+	require.Error(t, err)
+}
+
+func TestLoadCommandEnv(t *testing.T) {
+	config, err := configuration.LoadString(`
+	port:            1234
+	user_secret_key: "key"
+	user_jwt_expiry: "2m"
+	apps: [{
+		name:    "app"
+		cmd_pre: {command: "true", env_file: ".env", inherit_env: "none"}
+		cmd: {command: "true", env_file: [".env", "other.env"], inherit_env: ["PATH"]}
+		assets: [{name: "asset", system_path: "/path", cmd: {command: "true", inherit_env: "all"}}]
+	}]
+	`)
+	require.NoError(t, err)
+	app := config.Apps[0]
+	assert.Equal(t, configuration.StringList{".env"}, app.CommandPre.EnvFile)
+	assert.Equal(t, configuration.InheritEnv{}, app.CommandPre.InheritEnv)
+	assert.Equal(t, configuration.StringList{".env", "other.env"}, app.Command.EnvFile)
+	assert.Equal(t, configuration.InheritEnv{"PATH"}, app.Command.InheritEnv)
+	assert.Nil(t, app.Assets[0].Command.InheritEnv)
+
+	_, err = configuration.LoadString(`
+	port:            1234
+	user_secret_key: "key"
+	user_jwt_expiry: "2m"
+	apps: [{name: "app", cmd: {command: "true", inherit_env: "some"}, assets: []}]
+	`)
+	require.Error(t, err)
+}
@@ -7,6 +7,25 @@ users: [...#User] // list of user allowed to interface with the updater
 apps: [...#Application] // list of the apps that the updater will update
 base_path?:             string // path where the temporal files used by the app will place
 
+// directory with .cue, .yaml or .json files that contribute apps entries. Each one of the files must have the shape of #Include
+// if the path is relative, is resolved against the directory of the main configuration file
+include?: string
+
+// where the cron jobs sent on the __jobs asset are installed (default "crond").
+//   crond:   files on the cron.d directory of the system cron daemon
+//   builtin: jobs run by the updater
+//   systemd: a .service and .timer unit per job
+cron_backend?: "crond" | "builtin" | "systemd"
+// directory of the cron backend files. For crond the cron.d directory (default /etc/cron.d),
+// for builtin the directory where the jobs are stored (default jobs, next to the main configuration file),
+// for systemd the directory of the units (default /etc/systemd/system).
+// if the path is relative, is resolved against the directory of the main configuration file
+cron_dir?: string
+
+#Include: {
+	apps: [...#Application]
+}
+
 // user credentials, represent a user that will be allowed to interact with the updater
 #User: {
 	name!:     string
@@ -14,10 +33,26 @@ base_path?:             string // path where the temporal files used by the app
 }
 
 #Application: {
+	// unique name of the app, used to address it on the api
 	name?:         string
 	auth_token?:   string
 	service?:      string
-	service_type?: "nssm" | "taskservice"
+	service_type?: #ServiceType
+	// the systemd service manager of the service (default "system")
+	service_scope?: #ServiceScope
+	// owner of the user services, the updater user if not set
+	service_user?: string
+	// what is done with the service on an update (default "stop-start")
+	service_action?: #ServiceAction
+	// time to wait for the service to be active after starting it (default 30s, 0s disables the wait)
+	start_timeout?: time.Duration()
+	// the container of a service of type container
+	container?: #Container
+	// app level services, stopped in order before the assets update and started in reverse order after.
+	// Use it instead of service when the app has more than one
+	services?: [...#Service]
+	// deploy the app to the idle one of two service instances and then switch the traffic to it
+	blue_green?: #BlueGreen
 	assets!: [...#Asset]
 
 	// Declares an assets dependency.
@@ -35,6 +70,52 @@ base_path?:             string // path where the temporal files used by the app
 	cmd?: #Command
 
 	github_release?: #GithubRelease
+
+	// defaults for the cron jobs sent on the __jobs asset
+	cron?: #Cron
+}
+
+#Service: {
+	name!: string
+	type?: #ServiceType
+	// the systemd service manager of the service (default "system")
+	scope?: #ServiceScope
+	// owner of the user services, the updater user if not set
+	user?: string
+	// what is done with the service on an update (default "stop-start")
+	action?: #ServiceAction
+	// time to wait for the service to be active after starting it (default 30s, 0s disables the wait)
+	start_timeout?: time.Duration()
+	// the container of a service of type container
+	container?: #Container
+}
+
+// the colors are blue and green. An update copies the assets to the release directory of the idle color,
+// restarts his instance, waits for it to be ready, runs the health check and the switch command and
+// stops the instance of the previous color. The assets system paths are relative to the release directory
+#BlueGreen: {
+	// template unit of the instances, like "app@.service" for app@blue.service and app@green.service
+	service!: =~"@"
+	type?:    #ServiceType
+	scope?:   #ServiceScope
+	user?:    string
+	// time to wait for the instance to be active after starting it (default 30s, 0s disables the wait)
+	start_timeout?: time.Duration()
+	// absolute path of the directory with the blue and green release directories and the active file
+	release_dir!: string
+	// command that checks the new instance, {{.Color}} is his color
+	health_check?: #Command
+	// command that sends the traffic to the color {{.Color}}, like rewriting an nginx upstream and reloading it
+	switch!: #Command
+}
+
+#Cron: {
+	// user that runs the jobs (default "root")
+	user?: =~"^[A-Za-z0-9_][A-Za-z0-9_.-]*$"
+	// enviroment variables of the jobs
+	env?: [=~"^[A-Za-z_][A-Za-z0-9_]*$"]: string
+	// where the output of the jobs is mailed, an empty string disables the mails
+	mailto?: string
 }
 
 #GithubRelease: {
@@ -43,13 +124,53 @@ base_path?:             string // path where the temporal files used by the app
 	owner!: string
 }
 
+// the service manager of the service. If not set the one of the host is detected on linux
+// (systemd, openrc, supervisord or runit, systemd if none is found) and taskservice is used on windows
+// container: the service is the name of a docker or podman container, described by the container field
+#ServiceType: "systemd" | "openrc" | "runit" | "supervisord" | "nssm" | "taskservice" | "container"
+
+// system: the service is managed by the system instance of systemd
+// user:   the service is a user unit, managed with systemctl --user by the instance of service_user.
+//         The user needs a running manager, enable lingering with loginctl enable-linger to keep it after logout
+#ServiceScope: "system" | "user"
+
+// stop-start: stop the service before copying the asset and start it after
+// restart:    copy the asset and restart the service
+// reload:     copy the asset and reload the service, for daemons that reload their configuration
+// none:       do nothing with the service
+#ServiceAction: "stop-start" | "restart" | "reload" | "none"
+
+#Container: {
+	runtime?: "docker" | "podman"
+	image!:   string
+	ports?: [...string]
+	volumes?: [...string]
+	env?: [string]: string
+	args?: [...string]
+	// the asset is a docker save tarball with the image, instead of pulling it. Only for assets
+	load: bool | *false
+}
+
 #Asset: {
 	// the name of the form field
 	name!:         string
 	service?:      string
-	service_type?: "nssm" | "taskservice"
+	service_type?: #ServiceType
+	// the systemd service manager of the service (default "system")
+	service_scope?: #ServiceScope
+	// owner of the user services, the updater user if not set
+	service_user?: string
+	// what is done with the service on an update (default "stop-start")
+	service_action?: #ServiceAction
+	// time to wait for the service to be active after starting it (default 30s, 0s disables the wait)
+	start_timeout?: time.Duration()
+	// the container of a service of type container
+	container?: #Container
 	system_path!:  string
 
+	// the asset is a systemd unit file. After copying it systemd is reloaded and the unit enabled
+	unit_file: bool | *false
+
 	// if keeps the previous version with at .old at the end
 	keep_old: bool | *false
 
@@ -62,12 +183,50 @@ base_path?:             string // path where the temporal files used by the app
 	cmd?:  #Command
 }
 
+// command, args, path, env and env_file values are go templates, see match.CommandVars
+// exactly one of command or script must be set
 #Command: {
-	command!: string
+	command?: string
+
+	// inline script run by the interpreter (default "bash") with the args as positional parameters.
+	// For shells the script runs in strict mode (set -euo pipefail) unless strict is false
+	script?:      string
+	interpreter?: string
+	strict?:      bool
 	args?: [...string]
 	path?: string
 
 	// Additional enviroments variables that should be passed to the command.
-	// The current process enviroment variables are passed.
+	// Values from env take precedence over the ones from env_file
 	env?: [string]: string
+	// dotenv files (KEY=value lines) loaded in order. Their values are masked on the logs
+	env_file?: string | [...string]
+	// the updater enviroment variables passed to the command: "all" (default), "none" or a list of names
+	inherit_env?: "all" | "none" | [...string]
+
+	// Maximum time the command can run. When it expires the command process group receives a SIGTERM
+	// and if it is still running after kill_grace (default 5s) a SIGKILL
+	timeout?:    time.Duration()
+	kill_grace?: time.Duration()
+
+	// user and group the command runs as. By default the command runs as the updater user.
+	// If only the user is set the primary group of the user is used
+	user?:  string
+	group?: string
+	// octal file mode creation mask, for example "022"
+	umask?: =~"^0?[0-7]{3}$"
+	limits?: {
+		cpu?:           uint // cpu time in seconds
+		address_space?: uint // virtual memory in bytes
+		open_files?:    uint // number of open file descriptors
+	}
+
+	// exit codes that are considered a success in addition to 0
+	allowed_exit_codes?: [...int]
+	// how a failure is reported on the update (default "error")
+	on_failure?: "error" | "warning" | "ignore"
+	// number of times the command is retried after a failure.
+	// The wait between attempts starts at retry_backoff (default 1s) and doubles on every retry
+	retries?:       uint
+	retry_backoff?: time.Duration()
 }
@@ -0,0 +1,102 @@
+package configuration
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	cuerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/token"
+)
+
+type ErrorKind string
+
+const (
+	KindSyntax             ErrorKind = "syntax"
+	KindSchema             ErrorKind = "schema"
+	KindInvalidPath        ErrorKind = "invalid_path"
+	KindDuplicateAssetName ErrorKind = "duplicate_asset_name"
+	KindDuplicateAppName   ErrorKind = "duplicate_app_name"
+	KindMissingDependency  ErrorKind = "missing_dependency"
+	KindDependencyCycle    ErrorKind = "dependency_cycle"
+	KindUnknownUser        ErrorKind = "unknown_user"
+	KindInvalidCommand     ErrorKind = "invalid_command"
+	KindInvalidContainer   ErrorKind = "invalid_container"
+)
+
+// ValidationError is a single problem found on the configuration.
+// File, Line and Column are only set when the problem can be tracked to a position of a file
+type ValidationError struct {
+	File    string    `json:"file,omitempty"`
+	Line    int       `json:"line,omitempty"`
+	Column  int       `json:"column,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Kind    ErrorKind `json:"kind"`
+	Message string    `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	builder := strings.Builder{}
+	if e.Line > 0 {
+		if e.File != "" {
+			builder.WriteString(e.File + ":")
+		}
+		builder.WriteString(strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Column) + " ")
+	}
+	if e.Path != "" {
+		builder.WriteString(e.Path + ": ")
+	}
+	builder.WriteString(e.Message)
+	return builder.String()
+}
+
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	result := strings.Builder{}
+	for _, err := range e {
+		result.WriteString(err.Error())
+		result.WriteByte('\n')
+	}
+	return result.String()
+}
+
+// errorPosition returns the first position of the error that belongs to a user file.
+// Positions inside definitions.cue are only used as a last resort
+func errorPosition(err cuerrors.Error) token.Position {
+	if pos := err.Position(); pos.IsValid() && pos.Filename() != definitionsFilename {
+		return pos.Position()
+	}
+	for _, pos := range err.InputPositions() {
+		if pos.IsValid() && pos.Filename() != definitionsFilename {
+			return pos.Position()
+		}
+	}
+	return err.Position().Position()
+}
+
+// wrapError converts cue errors to ValidationErrors of the given kind, any other error is returned as is
+func wrapError(err error, kind ErrorKind) error {
+	cuerr, ok := err.(cuerrors.Error)
+	if !ok || cuerr == nil {
+		return err
+	}
+	errs := cuerrors.Errors(cuerr)
+	result := make(ValidationErrors, 0, len(errs))
+	for _, e := range errs {
+		position := errorPosition(e)
+		format, args := e.Msg()
+		verr := ValidationError{
+			Path:    strings.Join(e.Path(), "."),
+			Kind:    kind,
+			Message: fmt.Sprintf(format, args...),
+		}
+		if position.IsValid() {
+			verr.File = position.Filename
+			verr.Line = position.Line
+			verr.Column = position.Column
+		}
+		result = append(result, verr)
+	}
+	return result
+}
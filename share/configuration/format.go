@@ -0,0 +1,49 @@
+package configuration
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Format of a configuration file
+type Format int
+
+const (
+	FormatCue Format = iota
+	FormatYAML
+	FormatJSON
+)
+
+// FormatFromPath returns the format of the configuration file from his extension.
+// Unknown extensions are treated as cue
+func FormatFromPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatCue
+	}
+}
+
+// IsConfigFile reports if path has one of the extensions of the supported configuration formats
+func IsConfigFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".cue", ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatYAML:
+		return "application/yaml"
+	case FormatJSON:
+		return "application/json"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
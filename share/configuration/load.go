@@ -1,72 +1,184 @@
 package configuration
 
 import (
-	"bytes"
 	_ "embed"
-	"io"
+	"errors"
 	"os"
-	"strings"
+	"path/filepath"
+	"slices"
 
+	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
-	cuerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/encoding/json"
+	"cuelang.org/go/encoding/yaml"
 )
 
-type cuerror struct {
-	error cuerrors.Error
-	lines uint
+const definitionsFilename = "definitions.cue"
+
+//go:embed definitions.cue
+var definitions string
+
+// Overlay maps a file path to the content that should be used instead of the one on disk
+type Overlay map[string][]byte
+
+type loader struct {
+	ctx     *cue.Context
+	schema  cue.Value
+	overlay Overlay
 }
 
-func (cerr cuerror) Error() string {
-	result := strings.Builder{}
-	errs := cuerrors.Errors(cerr.error)
-	for _, err := range errs {
-		position := err.Position().Position()
-		if position.IsValid() {
-			position.Line -= int(cerr.lines)
-			result.WriteString(position.String())
-			result.WriteString(" ")
-		}
-		result.WriteString(err.Error())
-		result.WriteByte('\n')
+func newLoader(overlay Overlay) *loader {
+	ctx := cuecontext.New()
+	schema := ctx.CompileString(definitions, cue.Filename(definitionsFilename))
+	if err := schema.Err(); err != nil {
+		panic("unreachable: invalid definitions.cue " + err.Error())
 	}
-	return result.String()
+	return &loader{ctx: ctx, schema: schema, overlay: overlay}
 }
 
-//go:embed definitions.cue
-var definitions string
+func (l *loader) readFile(path string) ([]byte, error) {
+	if data, ok := l.overlay[filepath.Clean(path)]; ok {
+		return data, nil
+	}
+	return os.ReadFile(path)
+}
 
-func _load(data string, lines uint) (c Configuration, err error) {
-	ctx := cuecontext.New()
-	value := ctx.CompileString(data)
+func (l *loader) decode(value cue.Value, v any) error {
+	return wrapError(value.Decode(v), KindSchema)
+}
+
+// compile builds the file using the decoder for his format
+func (l *loader) compile(path string, data []byte, scope cue.Value) (cue.Value, error) {
+	switch FormatFromPath(path) {
+	case FormatYAML:
+		file, err := yaml.Extract(path, data)
+		if err != nil {
+			return cue.Value{}, wrapError(err, KindSyntax)
+		}
+		return l.built(l.ctx.BuildFile(file, cue.Filename(path), cue.Scope(scope)))
+	case FormatJSON:
+		expr, err := json.Extract(path, data)
+		if err != nil {
+			return cue.Value{}, wrapError(err, KindSyntax)
+		}
+		return l.built(l.ctx.BuildExpr(expr, cue.Filename(path), cue.Scope(scope)))
+	default:
+		return l.built(l.ctx.CompileBytes(data, cue.Filename(path), cue.Scope(scope)))
+	}
+}
 
-	var config Configuration
-	err = value.Decode(&config)
-	if err, ok := err.(cuerrors.Error); ok && err != nil {
-		return config, cuerror{err, lines}
+// built reports the errors found while building a file as syntax errors
+func (l *loader) built(value cue.Value) (cue.Value, error) {
+	if err := value.Err(); err != nil {
+		return value, wrapError(err, KindSyntax)
 	}
-	return config, err
+	return value, nil
 }
 
-func Load(userConfigPath string) (c Configuration, err error) {
-	f, err := os.Open(userConfigPath)
+func (l *loader) load(path string, data []byte) (config Configuration, err error) {
+	user, err := l.compile(path, data, l.schema)
 	if err != nil {
 		return
 	}
-	defer f.Close()
+	value := l.schema.Unify(user)
+	if err = l.decode(value, &config); err != nil {
+		return
+	}
+	if config.Include == "" {
+		return
+	}
 
-	buff := bytes.Buffer{}
-	_, err = io.Copy(&buff, f)
+	files, err := l.includeFiles(IncludeDir(config, path))
+	if err != nil {
+		return
+	}
+	include := l.schema.LookupPath(cue.MakePath(cue.Def("Include")))
+	for _, file := range files {
+		if data, err = l.readFile(file); err != nil {
+			return
+		}
+		var included cue.Value
+		if included, err = l.compile(file, data, value); err != nil {
+			return
+		}
+
+		var decoded struct {
+			Apps []Application `json:"apps"`
+		}
+		if err = l.decode(include.Unify(included), &decoded); err != nil {
+			return
+		}
+		config.Apps = append(config.Apps, decoded.Apps...)
+	}
+	return
+}
+
+// includeFiles list the configuration files inside dir, including the ones only present on the overlay
+func (l *loader) includeFiles(dir string) ([]string, error) {
+	files, err := IncludeFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	for path := range l.overlay {
+		if filepath.Dir(path) == filepath.Clean(dir) && IsConfigFile(path) && !slices.Contains(files, path) {
+			files = append(files, path)
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// IncludeDir returns the path of the include directory of the configuration or an empty string
+// if the configuration does not have one. A relative include is resolved against the directory of configPath
+func IncludeDir(config Configuration, configPath string) string {
+	if config.Include == "" {
+		return ""
+	}
+	if filepath.IsAbs(config.Include) {
+		return filepath.Clean(config.Include)
+	}
+	return filepath.Join(filepath.Dir(configPath), config.Include)
+}
+
+// IncludeFiles returns the sorted list of configuration files inside dir
+func IncludeFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !IsConfigFile(entry.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+func Load(userConfigPath string) (c Configuration, err error) {
+	return LoadOverlay(userConfigPath, nil)
+}
+
+// LoadOverlay loads the configuration at userConfigPath and his include directory.
+// Files present on the overlay are read from it instead of from disk
+func LoadOverlay(userConfigPath string, overlay Overlay) (c Configuration, err error) {
+	clean := make(Overlay, len(overlay))
+	for path, data := range overlay {
+		clean[filepath.Clean(path)] = data
+	}
+	l := newLoader(clean)
+	data, err := l.readFile(userConfigPath)
 	if err != nil {
 		return
 	}
-	return LoadString(buff.String())
+	return l.load(userConfigPath, data)
 }
 
 func LoadString(userConfig string) (c Configuration, err error) {
-	// 70 is the number of lines in definitions.cue
-	// when i tried to count the number of lines with strings.Count(userConfig, "\")
-	// it gave me 69 wich is wrong.
-	//
-	// So i let this for now... TODO make sure this is always sync with definitions.cue
-	return _load(definitions+"\n"+userConfig, 70)
+	return newLoader(nil).load("", []byte(userConfig))
 }
@@ -0,0 +1,256 @@
+package match
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ross96D/updater/share/configuration"
+)
+
+// colors of the instances of a blue/green app
+const (
+	ColorBlue  = "blue"
+	ColorGreen = "green"
+)
+
+// files of the release directory with the color that serves the traffic and the color that served it
+// before the last switch. The previous color is removed when his release directory is replaced
+const (
+	activeColorFile   = "active"
+	previousColorFile = "previous"
+)
+
+// ErrNotBlueGreen is returned by Rollback for the apps without blue_green
+var ErrNotBlueGreen = errors.New("the app is not a blue/green app")
+
+// ErrNoPreviousColor is returned by Rollback when the other color does not hold a release that served the traffic
+var ErrNoPreviousColor = errors.New("there is no previous color")
+
+// ActiveColor returns the color that serves the traffic of a blue/green app, empty if it was never deployed
+func ActiveColor(bg configuration.BlueGreen) (string, error) {
+	return readColor(bg, activeColorFile)
+}
+
+// PreviousColor returns the color that served the traffic before the last switch, empty if there is none
+// or his release was replaced after it
+func PreviousColor(bg configuration.BlueGreen) (string, error) {
+	return readColor(bg, previousColorFile)
+}
+
+func readColor(bg configuration.BlueGreen, name string) (string, error) {
+	path := filepath.Join(bg.ReleaseDir, name)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	color := strings.TrimSpace(string(data))
+	if color != ColorBlue && color != ColorGreen {
+		return "", fmt.Errorf("invalid color %q on %s", color, path)
+	}
+	return color, nil
+}
+
+// writeColor writes a color file, the file is replaced so it is never left half written
+func writeColor(bg configuration.BlueGreen, name string, color string) error {
+	path := filepath.Join(bg.ReleaseDir, name)
+	if err := os.WriteFile(path+".tmp", []byte(color+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// removePreviousColor removes the previous color, after it the app can not be rolled back
+func removePreviousColor(bg configuration.BlueGreen) error {
+	err := os.Remove(filepath.Join(bg.ReleaseDir, previousColorFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// otherColor returns the idle color when color is active. If no color is active blue is used first
+func otherColor(color string) string {
+	if color == ColorBlue {
+		return ColorGreen
+	}
+	return ColorBlue
+}
+
+// colorInstance returns the instance of the template unit for the color, app@.service is app@blue.service for blue
+func colorInstance(service string, color string) string {
+	prefix, suffix, _ := strings.Cut(service, "@")
+	return prefix + "@" + color + suffix
+}
+
+// colorDir returns the release directory of the color
+func colorDir(bg configuration.BlueGreen, color string) string {
+	return filepath.Join(bg.ReleaseDir, color)
+}
+
+// isError reports if err fails the update, a warning does not
+func isError(err error) bool {
+	var warning ErrWarning
+	return err != nil && !errors.As(err, &warning)
+}
+
+// deployColor sets the assets of the update on the release directory of color. The directory starts as a copy
+// of the release of the active color, so the assets that are not on the update keep their current version
+func (u *appUpdater) deployColor(active string, color string) error {
+	bg := *u.app.BlueGreen
+	dir := colorDir(bg, color)
+	if !u.dryRun {
+		// the release of color is replaced, it is not a rollback target anymore
+		if err := removePreviousColor(bg); err != nil {
+			return ErrError{err}
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return ErrError{err}
+		}
+		if err := seedColorDir(dir, active, bg); err != nil {
+			return ErrError{fmt.Errorf("copying the release of %s %w", active, err)}
+		}
+	}
+	u.color = color
+	// the assets are shared with the configuration
+	u.app.Assets = slices.Clone(u.app.Assets)
+	u.app.AsstesOrder = slices.Clone(u.app.AsstesOrder)
+	for i := range u.app.Assets {
+		u.app.Assets[i].SystemPath = filepath.Join(dir, u.app.Assets[i].SystemPath)
+	}
+	for i := range u.app.AsstesOrder {
+		u.app.AsstesOrder[i].SystemPath = filepath.Join(dir, u.app.AsstesOrder[i].SystemPath)
+	}
+	return nil
+}
+
+// seedColorDir creates dir as a copy of the release directory of the active color, empty if there is none
+func seedColorDir(dir string, active string, bg configuration.BlueGreen) error {
+	if active == "" {
+		return os.MkdirAll(dir, 0755)
+	}
+	src := colorDir(bg, active)
+	if _, err := os.Stat(src); errors.Is(err, os.ErrNotExist) {
+		return os.MkdirAll(dir, 0755)
+	}
+	return os.CopyFS(dir, os.DirFS(src))
+}
+
+// switchColor starts the instance of the color to, checks that it is ready and healthy, switches the traffic
+// to it and stops the instance of the color from, which is empty on the first deploy.
+// If the new instance is not healthy it is stopped, and if the switch fails the traffic is switched back
+func (u *appUpdater) switchColor(from string, to string) error {
+	bg := u.app.BlueGreen
+	config := serviceConfig(bg.Type, bg.Scope, bg.User, nil)
+	next := colorInstance(bg.Service, to)
+
+	u.log.Info().Msgf("starting %s", next)
+	err := u.serviceAction(u.log, next, config, configuration.ServiceActionRestart, bg.StartTimeout)
+	u.addServiceResult(next, "start", err)
+	if err == nil && bg.HealthCheck != nil && u.ctx.Err() == nil {
+		u.log.Info().Msgf("checking the health of %s", next)
+		err = u.runCommandVars(u.log, *bg.HealthCheck, u.commandVars(configuration.Asset{}, to), "health_check")
+	}
+	if isError(err) || u.ctx.Err() != nil {
+		u.log.Error().Msgf("%s is not healthy, the traffic is not switched", next)
+		u.stopColor(next)
+		u.discardPrevious(to)
+		return err
+	}
+
+	u.log.Info().Msgf("switching the traffic to %s", to)
+	if err = u.runCommandVars(u.log, *bg.Switch, u.commandVars(configuration.Asset{}, to), "switch"); isError(err) {
+		if from != "" {
+			u.log.Warn().Msgf("switching the traffic back to %s", from)
+			if errBack := u.runCommandVars(u.log, *bg.Switch, u.commandVars(configuration.Asset{}, from), "switch"); errBack != nil {
+				u.log.Error().Err(errBack).Msgf("switching the traffic back to %s", from)
+			}
+		}
+		u.stopColor(next)
+		u.discardPrevious(to)
+		return err
+	}
+	if !u.dryRun {
+		if err := writeColor(*bg, activeColorFile, to); err != nil {
+			return ErrError{fmt.Errorf("saving the active color %w", err)}
+		}
+	}
+	u.log.Info().Msgf("%s is the active color", to)
+
+	if from == "" {
+		return nil
+	}
+	u.stopColor(colorInstance(bg.Service, from))
+	// the release of from served the traffic, it can be rolled back to
+	if !u.dryRun {
+		if err := writeColor(*bg, previousColorFile, from); err != nil {
+			u.log.Warn().Err(err).Msg("saving the previous color")
+			return ErrWarning{fmt.Errorf("saving the previous color %w", err)}
+		}
+	}
+	return nil
+}
+
+// discardPrevious marks the release of color as not valid for a rollback, when it fails to become active
+func (u *appUpdater) discardPrevious(color string) {
+	bg := *u.app.BlueGreen
+	if u.dryRun {
+		return
+	}
+	if previous, err := PreviousColor(bg); err == nil && previous != color {
+		return
+	}
+	if err := removePreviousColor(bg); err != nil {
+		u.log.Error().Err(err).Msgf("discarding the release of %s", color)
+	}
+}
+
+// stopColor stops an instance that does not serve the traffic, a failure is only logged
+func (u *appUpdater) stopColor(name string) {
+	bg := u.app.BlueGreen
+	u.log.Info().Msgf("stopping %s", name)
+	err := u.io.ServiceStop(name, serviceConfig(bg.Type, bg.Scope, bg.User, nil))
+	u.addServiceResult(name, "stop", err)
+	if err != nil {
+		u.log.Warn().Err(err).Msgf("stopping %s", name)
+	}
+}
+
+// Rollback switches the traffic of a blue/green app back to the previous color, whose release is kept
+// on his directory. Only a release that served the traffic and was not replaced after it is rolled back to.
+// It is registered like an update
+func Rollback(ctx context.Context, app configuration.Application, opts ...UpdateOpts) (result Result) {
+	u := NewAppUpdater(ctx, app, opts...)
+	u.ctx, result.ID = updates.start(ctx, u.requestID, app.Name, u.dryRun)
+	defer u.finish(&result)
+
+	if app.BlueGreen == nil {
+		result.Add(ErrError{ErrNotBlueGreen})
+		return
+	}
+	active, err := ActiveColor(*app.BlueGreen)
+	if err != nil {
+		result.Add(ErrError{err})
+		return
+	}
+	previous, err := PreviousColor(*app.BlueGreen)
+	if err != nil {
+		result.Add(ErrError{err})
+		return
+	}
+	if active == "" || previous != otherColor(active) {
+		result.Add(ErrError{ErrNoPreviousColor})
+		return
+	}
+	u.log.Info().Msgf("rolling back from %s to %s", active, previous)
+	u.color = previous
+	result.Add(u.switchColor(active, previous))
+	return
+}
@@ -2,13 +2,16 @@ package match
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ross96D/updater/share/configuration"
 	"github.com/ross96D/updater/share/utils"
@@ -22,10 +25,31 @@ const (
 	stderr
 )
 
+func (p pipeType) String() string {
+	switch p {
+	case stdout:
+		return "stdout"
+	case stderr:
+		return "stderr"
+	default:
+		return "unknown"
+	}
+}
+
+// number of lines of each stream kept on the command result
+const outputTailLines = 50
+
+// OutputLine is a line written by a command to stdout or stderr
+type OutputLine struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
 type streamConsumer struct {
 	logger      *zerolog.Logger
 	ptype       pipeType
 	notConsumed []byte
+	tail        []OutputLine
 	isClosed    atomic.Bool
 	mut         sync.Mutex
 }
@@ -44,15 +68,19 @@ func (consumer *streamConsumer) consume(all bool) {
 	consumer.mut.Lock()
 	defer consumer.mut.Unlock()
 
-	var event func() *zerolog.Event
-	switch consumer.ptype {
-	case stdout:
-		event = func() *zerolog.Event {
-			return consumer.logger.Info().Str("pipe", "stdout") //nolint: zerologlint
+	now := time.Now()
+	line := func(text string) {
+		var event *zerolog.Event
+		if consumer.ptype == stderr {
+			event = consumer.logger.Warn()
+		} else {
+			event = consumer.logger.Info()
 		}
-	case stderr:
-		event = func() *zerolog.Event {
-			return consumer.logger.Warn().Str("pipe", "stderr") //nolint: zerologlint
+		event.Str("pipe", consumer.ptype.String()).Time("ts", now).Msg(text)
+
+		consumer.tail = append(consumer.tail, OutputLine{Time: now, Text: text})
+		if len(consumer.tail) > outputTailLines {
+			consumer.tail = slices.Delete(consumer.tail, 0, len(consumer.tail)-outputTailLines)
 		}
 	}
 
@@ -62,19 +90,25 @@ func (consumer *streamConsumer) consume(all bool) {
 		if index == -1 {
 			break
 		}
-		// TODO test what happens if index + 1 equals len
-		event().Msg(string(consumer.notConsumed[start : start+index]))
+		line(string(consumer.notConsumed[start : start+index]))
 		start = start + index + 1
 	}
 	copy(consumer.notConsumed, consumer.notConsumed[start:])
 	consumer.notConsumed = consumer.notConsumed[:len(consumer.notConsumed)-start]
 
 	if all && len(consumer.notConsumed) > 0 {
-		event().Msg(string(consumer.notConsumed))
+		line(string(consumer.notConsumed))
 		consumer.notConsumed = consumer.notConsumed[0:0]
 	}
 }
 
+// Tail returns the last lines written to the stream
+func (consumer *streamConsumer) Tail() []OutputLine {
+	consumer.mut.Lock()
+	defer consumer.mut.Unlock()
+	return slices.Clone(consumer.tail)
+}
+
 func (consumer *streamConsumer) Write(p []byte) (int, error) {
 	if consumer.isClosed.Load() {
 		return 0, errors.New("called write on closed stream")
@@ -96,17 +130,180 @@ func parseEnvMap(envs map[string]string) []string {
 	return env
 }
 
+// ErrCommandTimeout is wrapped by the error returned when a command exceeds his timeout
+var ErrCommandTimeout = errors.New("command timed out")
+
+const defaultKillGrace = 5 * time.Second
+
+const defaultRetryBackoff = time.Second
+
+const maxRetryBackoff = time.Minute
+
+// CommandAttempt is a single run of a command
+type CommandAttempt struct {
+	Attempt  int           `json:"attempt"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	// last lines of each stream
+	Stdout []OutputLine `json:"stdout,omitempty"`
+	Stderr []OutputLine `json:"stderr,omitempty"`
+}
+
+// CommandResult has all the attempts made to run a command.
+// ExitCode is the one of the last attempt and Duration the sum of all the attempts
+type CommandResult struct {
+	Command  string           `json:"command"`
+	Asset    string           `json:"asset,omitempty"` // empty for application level commands
+	Kind     string           `json:"kind"`            // pre, post, health_check or switch
+	ExitCode int              `json:"exit_code"`
+	Duration time.Duration    `json:"duration"`
+	Attempts []CommandAttempt `json:"attempts"`
+}
+
+// commandOutput are the tails of the command streams
+type commandOutput struct {
+	stdout []OutputLine
+	stderr []OutputLine
+}
+
 func RunCommand(logger *zerolog.Logger, command configuration.Command) error {
-	cmd := exec.Command(command.Command, command.Args...)
-	if command.Env != nil && len(command.Env) > 0 {
-		env := os.Environ()
-		env = append(env, parseEnvMap(command.Env)...)
-		cmd.Env = env
+	_, err := RunCommandContext(context.Background(), logger, command)
+	return err
+}
+
+func RunCommandWithResult(logger *zerolog.Logger, command configuration.Command) (CommandResult, error) {
+	return RunCommandContext(context.Background(), logger, command)
+}
+
+// RunCommandContext runs the command retrying it up to command.Retries times with an exponential backoff.
+// A failure is reported according to command.OnFailure, the exit codes in command.AllowedExitCodes
+// and 0 are not considered failures.
+// When ctx is cancelled the command process group is terminated like on a timeout and it is not retried,
+// the failure is always reported as an error
+func RunCommandContext(ctx context.Context, logger *zerolog.Logger, command configuration.Command) (result CommandResult, err error) {
+	name := maskSecrets(command.String(), envFileSecrets(command))
+	result.Command = name
+	backoff := command.RetryBackoff.GoDuration()
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	attempts := int(command.Retries) + 1
+	for i := 1; i <= attempts; i++ {
+		start := time.Now()
+		var output commandOutput
+		output, err = runAttempt(ctx, logger, command)
+		attempt := CommandAttempt{
+			Attempt:  i,
+			ExitCode: exitCode(err),
+			Duration: time.Since(start),
+			Stdout:   output.stdout,
+			Stderr:   output.stderr,
+		}
+		if err != nil && attempt.ExitCode > 0 && slices.Contains(command.AllowedExitCodes, attempt.ExitCode) {
+			err = nil
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		result.Attempts = append(result.Attempts, attempt)
+		result.ExitCode = attempt.ExitCode
+		result.Duration += attempt.Duration
+		logger.Info().
+			Int("attempt", attempt.Attempt).
+			Int("exit_code", attempt.ExitCode).
+			Dur("duration", attempt.Duration).
+			Msgf("command attempt %d of %d finished", i, attempts)
+		if err == nil {
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			logger.Error().Err(err).Msgf("command %s cancelled", name)
+			return result, err
+		}
+
+		if i < attempts {
+			logger.Warn().Err(err).Msgf("command %s failed, retrying in %s", name, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				logger.Error().Msgf("command %s cancelled", name)
+				return result, ErrError{fmt.Errorf("command %s %w", name, ctx.Err())}
+			}
+			backoff = min(backoff*2, maxRetryBackoff)
+		}
+	}
+
+	switch command.OnFailure {
+	case "warning":
+		logger.Warn().Err(err).Msgf("command %s", name)
+		return result, ErrWarning{errors.Unwrap(err)}
+	case "ignore":
+		logger.Info().Err(err).Msgf("ignoring failure of command %s", name)
+		return result, nil
+	default:
+		logger.Error().Err(err).Msgf("command %s", name)
+		return result, err
+	}
+}
+
+// exitCode returns the exit code of the command, -1 if the command could not be started or was killed
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
 	}
+	return -1
+}
+
+// runAttempt runs the command once, the error is always an ErrError
+func runAttempt(ctx context.Context, logger *zerolog.Logger, command configuration.Command) (output commandOutput, err error) {
+	if err := ctx.Err(); err != nil {
+		return output, ErrError{err}
+	}
+	id, err := lookupIdentity(command)
+	if err != nil {
+		return output, ErrError{err}
+	}
+	var cmd *exec.Cmd
+	if command.Script != "" {
+		path, err := writeScript(command)
+		if err != nil {
+			return output, ErrError{fmt.Errorf("writing script %w", err)}
+		}
+		defer os.Remove(path)
+		if err = chownScript(path, id); err != nil {
+			return output, ErrError{fmt.Errorf("writing script %w", err)}
+		}
+		cmd = exec.Command(command.InterpreterOrDefault(), append([]string{path}, command.Args...)...)
+	} else {
+		cmd = exec.Command(command.Command, command.Args...)
+	}
+	env, secrets, err := commandEnv(command, id)
+	if err != nil {
+		return output, ErrError{err}
+	}
+	cmd.Env = env
 	if command.Path != "" {
 		cmd.Dir = command.Path
 	}
-	logger.Info().Str("path", cmd.Dir).Str("cmd", cmd.String()).Send()
+	setProcessGroup(cmd)
+	if err = setIdentity(cmd, id); err != nil {
+		return output, ErrError{err}
+	}
+	if err = setLimits(cmd, command); err != nil {
+		return output, ErrError{err}
+	}
+	logger.Info().
+		Str("path", cmd.Dir).
+		Str("cmd", maskSecrets(cmd.String(), secrets)).
+		Str("env", envString(env, secrets)).
+		Str("identity", id.String()).
+		Send()
 
 	buffout := &utils.StreamBuffer{}
 	cmd.Stdout = buffout
@@ -114,23 +311,91 @@ func RunCommand(logger *zerolog.Logger, command configuration.Command) error {
 	cmd.Stderr = bufferr
 
 	outconsumer := &streamConsumer{logger: logger, ptype: stdout}
-	errconsumer := &streamConsumer{logger: logger, ptype: stdout}
+	errconsumer := &streamConsumer{logger: logger, ptype: stderr}
 
-	go io.Copy(outconsumer, buffout) //nolint errcheck
-	go io.Copy(errconsumer, bufferr) //nolint errcheck
+	copying := sync.WaitGroup{}
+	copying.Add(2)
+	go func() {
+		io.Copy(outconsumer, buffout) //nolint errcheck
+		copying.Done()
+	}()
+	go func() {
+		io.Copy(errconsumer, bufferr) //nolint errcheck
+		copying.Done()
+	}()
 
-	err := cmd.Run()
+	err = cmd.Start()
+	timedOut, cancelled := false, false
+	if err == nil {
+		timedOut, cancelled, err = wait(ctx, logger, cmd, command)
+	}
 
 	buffout.End.Store(true)
 	bufferr.End.Store(true)
+	// wait for the consumers to receive all the output before closing them
+	copying.Wait()
 	outconsumer.isClosed.Store(true)
 	errconsumer.isClosed.Store(true)
 	outconsumer.consume(true)
 	errconsumer.consume(true)
+	output.stdout = outconsumer.Tail()
+	output.stderr = errconsumer.Tail()
 
+	if cancelled {
+		return output, ErrError{fmt.Errorf("%w: %s", ctx.Err(), maskSecrets(cmd.String(), secrets))}
+	}
+	if timedOut {
+		return output, ErrError{fmt.Errorf("%w after %s: %s", ErrCommandTimeout, command.Timeout.GoDuration(), maskSecrets(cmd.String(), secrets))}
+	}
 	if err != nil {
-		logger.Error().Err(err).Msgf("post command %s", cmd.String())
-		return ErrError{err}
+		return output, ErrError{err}
+	}
+	return output, nil
+}
+
+// wait waits for the command to finish. If the command timeout expires or ctx is cancelled the process group
+// receives a SIGTERM and, if it is still running after the kill grace period, a SIGKILL
+func wait(ctx context.Context, logger *zerolog.Logger, cmd *exec.Cmd, command configuration.Command) (timedOut bool, cancelled bool, err error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if command.Timeout > 0 {
+		timer := time.NewTimer(command.Timeout.GoDuration())
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case err = <-done:
+		return false, false, err
+	case <-timeout:
+		timedOut = true
+		logger.Warn().Msgf("command timed out after %s, terminating process group", command.Timeout.GoDuration())
+	case <-ctx.Done():
+		cancelled = true
+		logger.Warn().Msg("command cancelled, terminating process group")
+	}
+
+	grace := command.KillGrace.GoDuration()
+	if grace <= 0 {
+		grace = defaultKillGrace
+	}
+	if err := terminateProcessGroup(cmd); err != nil {
+		logger.Warn().Err(err).Msg("terminating process group")
+	}
+	graceTimer := time.NewTimer(grace)
+	defer graceTimer.Stop()
+	select {
+	case err = <-done:
+		return timedOut, cancelled, err
+	case <-graceTimer.C:
+	}
+
+	logger.Warn().Msgf("command still running after %s, killing process group", grace)
+	if err := killProcessGroup(cmd); err != nil {
+		logger.Warn().Err(err).Msg("killing process group")
 	}
-	return nil
+	return timedOut, cancelled, <-done
 }
@@ -0,0 +1,114 @@
+//go:build !windows
+
+package match
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/ross96D/updater/share/configuration"
+)
+
+// shellCommand returns the command and arguments that run the command line on the shell
+func shellCommand(command string) (string, []string) {
+	return "sh", []string{"-c", command}
+}
+
+// setProcessGroup makes the command the leader of a new process group
+// so the signals reach all the processes created by it
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// setIdentity makes the command run as the given identity. If only the group is set the command
+// keeps the user of the updater
+func setIdentity(cmd *exec.Cmd, id identity) error {
+	if id.isZero() {
+		return nil
+	}
+	credential := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+	if id.user != nil {
+		uid, err := strconv.ParseUint(id.user.Uid, 10, 32)
+		if err != nil {
+			return err
+		}
+		gid, err := strconv.ParseUint(id.user.Gid, 10, 32)
+		if err != nil {
+			return err
+		}
+		credential.Uid = uint32(uid)
+		credential.Gid = uint32(gid)
+
+		groups, err := id.user.GroupIds()
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			gid, err := strconv.ParseUint(group, 10, 32)
+			if err != nil {
+				return err
+			}
+			credential.Groups = append(credential.Groups, uint32(gid))
+		}
+	}
+	if id.group != nil {
+		gid, err := strconv.ParseUint(id.group.Gid, 10, 32)
+		if err != nil {
+			return err
+		}
+		credential.Gid = uint32(gid)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = credential
+	return nil
+}
+
+// setLimits makes the child apply the umask and resource limits before executing the command.
+// The command is wrapped by sh so the limits only affect the child
+func setLimits(cmd *exec.Cmd, command configuration.Command) error {
+	script := limitsScript(command)
+	if script == "" {
+		return nil
+	}
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		return err
+	}
+	cmd.Args = append([]string{"sh", "-c", script + ` && exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shell
+	return nil
+}
+
+// chownScript gives the ownership of the script to the user that runs the command
+func chownScript(path string, id identity) error {
+	if id.isZero() {
+		return nil
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	if id.user != nil {
+		uid, _ = strconv.Atoi(id.user.Uid)
+		gid, _ = strconv.Atoi(id.user.Gid)
+	}
+	if id.group != nil {
+		gid, _ = strconv.Atoi(id.group.Gid)
+	}
+	return os.Chown(path, uid, gid)
+}
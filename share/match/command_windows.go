@@ -0,0 +1,50 @@
+//go:build windows
+
+package match
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+
+	"github.com/ross96D/updater/share/configuration"
+)
+
+// shellCommand returns the command and arguments that run the command line on cmd.exe
+func shellCommand(command string) (string, []string) {
+	return "cmd", []string{"/C", command}
+}
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// windows does not have SIGTERM, the process is killed right away
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+func setIdentity(_ *exec.Cmd, id identity) error {
+	if id.isZero() {
+		return nil
+	}
+	return errors.New("running commands as another user is not supported on windows")
+}
+
+func setLimits(_ *exec.Cmd, command configuration.Command) error {
+	if limitsScript(command) == "" {
+		return nil
+	}
+	return errors.New("umask and resource limits are not supported on windows")
+}
+
+func chownScript(_ string, _ identity) error {
+	return nil
+}
@@ -0,0 +1,247 @@
+package match
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	CronBackendCronD   = "crond"
+	CronBackendBuiltin = "builtin"
+	CronBackendSystemd = "systemd"
+)
+
+const DefaultCronDir = "/etc/cron.d"
+
+// CronBackend installs the cron jobs deployed with the __jobs asset
+type CronBackend interface {
+	// Install replaces the jobs of the application
+	Install(app string, tab CronTab) error
+	// Installed returns the jobs of the application, an empty tab if there are none
+	Installed(app string) (CronTab, error)
+	// Remove removes the jobs of the application, it does nothing if there are none
+	Remove(app string) error
+	// Apps returns the applications with jobs installed by the updater
+	Apps() ([]string, error)
+}
+
+var (
+	cronBackendMut sync.RWMutex
+	cronBackend    CronBackend = CronD{Dir: DefaultCronDir}
+)
+
+// SetCronBackend replaces the backend used to install the cron jobs.
+// The previous backend is stopped if it is a Scheduler
+func SetCronBackend(backend CronBackend) {
+	cronBackendMut.Lock()
+	previous := cronBackend
+	cronBackend = backend
+	cronBackendMut.Unlock()
+
+	if scheduler, ok := previous.(*Scheduler); ok && previous != backend {
+		scheduler.Stop()
+	}
+}
+
+func CurrentCronBackend() CronBackend {
+	cronBackendMut.RLock()
+	defer cronBackendMut.RUnlock()
+	return cronBackend
+}
+
+// InstalledCronJobs returns the jobs of the application on the current backend
+func InstalledCronJobs(app string) (CronTab, error) {
+	return CurrentCronBackend().Installed(app)
+}
+
+// cronOwnerHeader is the first line of the cron.d files written by the updater, followed by the app name.
+// Files without it are not touched by Remove nor listed by Apps
+const cronOwnerHeader = "# updater app: "
+
+// CronD writes the jobs of each application to a file on the cron.d directory of the system cron daemon
+type CronD struct {
+	Dir string
+}
+
+func (c CronD) Install(app string, tab CronTab) error {
+	if app == "" {
+		return errors.New("cron Install() app name is empty")
+	}
+	name, err := CronFileName(app)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.Dir, name)
+	// a file that is not written by the updater for the app, like a system cron file, is not replaced
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if owner, ok := cronFileOwner(current); !ok || owner != app {
+			return fmt.Errorf("cron Install() %s is not owned by the app %q", path, app)
+		}
+	}
+	data := append([]byte(cronOwnerHeader+app+"\n"), CreateJobConfigurationData(tab)...)
+	return writeFileAtomic(path, data, 0644)
+}
+
+func (c CronD) Installed(app string) (CronTab, error) {
+	tab := CronTab{Jobs: []CronJob{}}
+	name, err := CronFileName(app)
+	if err != nil {
+		// the jobs of this app can not be installed
+		return tab, nil
+	}
+	data, err := os.ReadFile(filepath.Join(c.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return tab, nil
+	}
+	if err != nil {
+		return tab, err
+	}
+	if owner, ok := cronFileOwner(data); !ok || owner != app {
+		return tab, nil
+	}
+	return parseCronFile(data), nil
+}
+
+func (c CronD) Remove(app string) error {
+	name, err := CronFileName(app)
+	if err != nil {
+		return nil
+	}
+	path := filepath.Join(c.Dir, name)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if owner, ok := cronFileOwner(data); !ok || owner != app {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+func (c CronD) Apps() ([]string, error) {
+	entries, err := os.ReadDir(c.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var apps []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(c.Dir, entry.Name()))
+		if err != nil {
+			return apps, err
+		}
+		if owner, ok := cronFileOwner(data); ok {
+			apps = append(apps, owner)
+		}
+	}
+	return apps, nil
+}
+
+// cronFileOwner returns the app name of the header of a file written by CronD
+func cronFileOwner(data []byte) (app string, ok bool) {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	app, ok = strings.CutPrefix(string(line), cronOwnerHeader)
+	return app, ok && app != ""
+}
+
+// CleanupCronJobs removes the jobs of the applications that are not on apps
+func CleanupCronJobs(logger *zerolog.Logger, apps []string) error {
+	backend := CurrentCronBackend()
+	installed, err := backend.Apps()
+	if err != nil {
+		return err
+	}
+	for _, app := range installed {
+		if slices.Contains(apps, app) {
+			continue
+		}
+		tab, err := backend.Installed(app)
+		if err != nil {
+			return err
+		}
+		for _, job := range tab.Jobs {
+			logger.Info().Str("app", app).Str("job", job.Name).Msg("cron job removed")
+		}
+		if err = backend.Remove(app); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateCronJobs moves the jobs installed on the previous backend to the next one, so they do not run twice
+// after a change of backend. The jobs of the applications that are not on apps are only removed
+func MigrateCronJobs(logger *zerolog.Logger, previous CronBackend, next CronBackend, apps []string) error {
+	installed, err := previous.Apps()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, app := range installed {
+		tab, err := previous.Installed(app)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if slices.Contains(apps, app) && len(tab.Jobs) > 0 {
+			if err = next.Install(app, tab); err != nil {
+				// the jobs keep running on the previous backend
+				errs = append(errs, err)
+				continue
+			}
+			for _, job := range tab.Jobs {
+				logger.Info().Str("app", app).Str("job", job.Name).Msg("cron job migrated")
+			}
+		} else {
+			for _, job := range tab.Jobs {
+				logger.Info().Str("app", app).Str("job", job.Name).Msg("cron job removed")
+			}
+		}
+		if err = previous.Remove(app); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeFileAtomic writes data to a temporal file on the same directory and renames it to path.
+// The temporal file name starts with a dot so cron ignores it
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -1,97 +1,312 @@
 package match
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/adhocore/gronx"
+	"github.com/ross96D/updater/share/configuration"
 )
 
-type cronJob struct {
+const defaultCronUser = "root"
+
+var (
+	cronUserRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+	cronEnvRegex  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// cron.d ignores files with names out of this set, like the ones with a dot
+	cronFileRegex = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+)
+
+type CronJob struct {
 	Name    string `json:"name"`
 	Command string `json:"command"`
 	Time    string `json:"time"`
+	// user that runs the job, by default the one of the CronTab
+	User string `json:"user,omitempty"`
+}
+
+// CronTab is the content of the __jobs asset. The asset can also be a single job or a list of jobs
+type CronTab struct {
+	User   string            `json:"user,omitempty"`
+	Env    map[string]string `json:"env,omitempty"`
+	MailTo *string           `json:"mailto,omitempty"`
+	Jobs   []CronJob         `json:"jobs"`
+}
+
+// withDefaults returns the tab with the values missing on the tab, and his jobs, taken from the configuration.
+// The values from the configuration env are overridden by the tab ones
+func (tab CronTab) withDefaults(config *configuration.Cron) CronTab {
+	if config == nil {
+		config = &configuration.Cron{}
+	}
+	result := tab
+	if result.User == "" {
+		result.User = config.User
+	}
+	if result.MailTo == nil {
+		result.MailTo = config.MailTo
+	}
+	if len(config.Env) > 0 {
+		result.Env = maps.Clone(config.Env)
+		maps.Copy(result.Env, tab.Env)
+	}
+	result.Jobs = slices.Clone(tab.Jobs)
+	for i := range result.Jobs {
+		if result.Jobs[i].User == "" {
+			result.Jobs[i].User = result.User
+		}
+	}
+	return result
 }
 
-func ValidateCronJobConfiguration(content []byte) ([]cronJob, error) {
+func ValidateCronJobConfiguration(content []byte) (CronTab, error) {
 	if len(content) == 0 {
-		return []cronJob{}, nil
+		return CronTab{Jobs: []CronJob{}}, nil
 	}
 
-	jobs, err := parseCronJobs(content)
+	tab, err := parseCronJobs(content)
 	if err != nil {
-		return nil, err
+		return tab, err
+	}
+
+	if tab.User != "" && !cronUserRegex.MatchString(tab.User) {
+		err = errors.Join(err, fmt.Errorf("%s is not a valid user", tab.User))
+	}
+	for k, v := range tab.Env {
+		if !cronEnvRegex.MatchString(k) {
+			err = errors.Join(err, fmt.Errorf("%s is not a valid enviroment variable name", k))
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			err = errors.Join(err, fmt.Errorf("enviroment variable %s has a new line", k))
+		}
+	}
+	if tab.MailTo != nil && strings.ContainsAny(*tab.MailTo, "\r\n") {
+		err = errors.Join(err, errors.New("mailto has a new line"))
 	}
 
 	parser := gronx.New()
-	for _, job := range jobs {
+	for _, job := range tab.Jobs {
 		if !parser.IsValid(job.Time) {
-			return nil, fmt.Errorf("%s: %s is not a valid cronjob expr", job.Name, job.Time)
+			err = errors.Join(err, fmt.Errorf("%s: %s is not a valid cronjob expr", job.Name, job.Time))
+		}
+		if job.User != "" && !cronUserRegex.MatchString(job.User) {
+			err = errors.Join(err, fmt.Errorf("%s: %s is not a valid user", job.Name, job.User))
 		}
+		if strings.ContainsAny(job.Name+job.Command, "\r\n") {
+			err = errors.Join(err, fmt.Errorf("%s: the name and command can not have new lines", job.Name))
+		}
+	}
+	if err != nil {
+		return CronTab{}, err
 	}
-	return jobs, nil
+	return tab, nil
 }
 
-func CreateJobConfigurationData(jobs []cronJob) []byte {
+func CreateJobConfigurationData(tab CronTab) []byte {
 	builder := bytes.Buffer{}
 
-	for _, job := range jobs {
+	if tab.MailTo != nil {
+		builder.WriteString(fmt.Sprintf("MAILTO=%s\n", cronEnvValue(*tab.MailTo)))
+	}
+	for _, k := range slices.Sorted(maps.Keys(tab.Env)) {
+		builder.WriteString(fmt.Sprintf("%s=%s\n", k, cronEnvValue(tab.Env[k])))
+	}
+	for _, job := range tab.Jobs {
+		user := job.User
+		if user == "" {
+			user = tab.User
+		}
+		if user == "" {
+			user = defaultCronUser
+		}
 		builder.WriteString(fmt.Sprintf("# %s\n", job.Name))
-		// TODO get the user from somewhere..........
-		builder.WriteString(fmt.Sprintf("%s root %s\n", job.Time, job.Command))
+		builder.WriteString(fmt.Sprintf("%s %s %s\n", job.Time, user, job.Command))
 	}
 	return builder.Bytes()
 }
 
-func createCronjobConfiguration(serviceName string, jobs []cronJob) error {
-	if serviceName == "" {
-		return errors.New("createCronjobConfiguration() serviceName is empty")
+// CronTabDiff are the changes needed to go from the installed jobs of an application to the desired ones
+type CronTabDiff struct {
+	Added   []CronJob
+	Changed []CronJob
+	Removed []CronJob
+	// the env or mailto of the tab changed, a change of the user shows on the jobs
+	Settings bool
+}
+
+func (d CronTabDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0 && !d.Settings
+}
+
+// DiffCronTabs compares the jobs by name. The jobs without user are compared with the user that will run them
+func DiffCronTabs(installed CronTab, desired CronTab) (diff CronTabDiff) {
+	effective := func(tab CronTab, job CronJob) CronJob {
+		if job.User == "" {
+			job.User = tab.User
+		}
+		if job.User == "" {
+			job.User = defaultCronUser
+		}
+		return job
+	}
+	previous := make(map[string]CronJob, len(installed.Jobs))
+	for _, job := range installed.Jobs {
+		previous[job.Name] = effective(installed, job)
+	}
+	for _, job := range desired.Jobs {
+		old, ok := previous[job.Name]
+		if !ok {
+			diff.Added = append(diff.Added, job)
+			continue
+		}
+		delete(previous, job.Name)
+		if old != effective(desired, job) {
+			diff.Changed = append(diff.Changed, job)
+		}
+	}
+	for _, job := range installed.Jobs {
+		if _, ok := previous[job.Name]; ok {
+			diff.Removed = append(diff.Removed, job)
+		}
+	}
+	diff.Settings = !maps.Equal(installed.Env, desired.Env) ||
+		(installed.MailTo == nil) != (desired.MailTo == nil) ||
+		(installed.MailTo != nil && *installed.MailTo != *desired.MailTo)
+	return diff
+}
+
+// cronEnvValue quotes the values that cron would change, cron strips the blanks around unquoted values
+func cronEnvValue(value string) string {
+	if value == "" || strings.TrimSpace(value) != value || strings.ContainsAny(value, `"'`) {
+		return strconv.Quote(value)
 	}
+	return value
+}
 
-	cronpath := filepath.Join("/etc/cron.d/", serviceName)
-	file, err := os.Create(cronpath)
-	if err != nil {
-		return err
+// CronFileName returns the name of the cron.d file of the application.
+// cron ignores the files with characters other than letters, digits, underscores and hyphens
+func CronFileName(appName string) (string, error) {
+	name := cronFileRegex.ReplaceAllString(appName, "_")
+	if strings.Trim(name, "_") == "" {
+		return "", fmt.Errorf("the app name %q is not valid for a cron file", appName)
 	}
-	_, err = file.Write(CreateJobConfigurationData(jobs))
-	return err
+	return name, nil
 }
 
-func parseCronJobs(content []byte) ([]cronJob, error) {
-	single := cronJob{}
-	err := json.Unmarshal(content, &single)
-	if err == nil {
-		var err error
-		if single.Name == "" {
-			err = errors.Join(err, errors.New("missing name field"))
+// parseCronFile parses the files created with CreateJobConfigurationData
+func parseCronFile(data []byte) CronTab {
+	tab := CronTab{Jobs: []CronJob{}}
+	comment := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, cronOwnerHeader):
+			continue
+		case strings.HasPrefix(line, "#"):
+			comment = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			continue
+		case strings.ContainsRune("0123456789*@", rune(line[0])):
+			timeFields := 5
+			if strings.HasPrefix(line, "@") {
+				timeFields = 1
+			}
+			fields, command := cutFields(line, timeFields+1)
+			if len(fields) < timeFields+1 || command == "" {
+				continue
+			}
+			tab.Jobs = append(tab.Jobs, CronJob{
+				Name:    comment,
+				Time:    strings.Join(fields[:timeFields], " "),
+				User:    fields[timeFields],
+				Command: command,
+			})
+		default:
+			k, v, found := strings.Cut(line, "=")
+			if !found {
+				continue
+			}
+			k, v = strings.TrimSpace(k), strings.TrimSpace(v)
+			if unquoted, err := strconv.Unquote(v); err == nil {
+				v = unquoted
+			}
+			if k == "MAILTO" {
+				tab.MailTo = &v
+				continue
+			}
+			if tab.Env == nil {
+				tab.Env = make(map[string]string)
+			}
+			tab.Env[k] = v
 		}
-		if single.Command == "" {
-			err = errors.Join(err, errors.New("missing command field"))
+		comment = ""
+	}
+	return tab
+}
+
+// cutFields returns the first n blank separated fields of line and the rest of the line as is
+func cutFields(line string, n int) (fields []string, rest string) {
+	rest = line
+	for range n {
+		rest = strings.TrimLeft(rest, " \t")
+		end := strings.IndexAny(rest, " \t")
+		if end == -1 {
+			if rest != "" {
+				fields = append(fields, rest)
+			}
+			return fields, ""
 		}
-		if single.Time == "" {
-			err = errors.Join(err, errors.New("missing time field"))
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
+	}
+	return fields, strings.TrimSpace(rest)
+}
+
+func parseCronJobs(content []byte) (CronTab, error) {
+	tab := CronTab{}
+	err := json.Unmarshal(content, &tab)
+	if err == nil && tab.Jobs != nil {
+		for i, job := range tab.Jobs {
+			err = errors.Join(err, validateJobFields(job, fmt.Sprintf(" for index %d", i)))
 		}
-		return []cronJob{single}, err
+		return tab, err
 	}
-	multiple := make([]cronJob, 0)
+
+	single := CronJob{}
+	err = json.Unmarshal(content, &single)
+	if err == nil {
+		return CronTab{Jobs: []CronJob{single}}, validateJobFields(single, "")
+	}
+	multiple := make([]CronJob, 0)
 	err = json.Unmarshal(content, &multiple)
 	if err != nil {
-		return nil, err
+		return CronTab{}, err
 	}
 	for i, job := range multiple {
-		if job.Name == "" {
-			err = errors.Join(err, fmt.Errorf("missing name field for index %d", i))
-		}
-		if job.Command == "" {
-			err = errors.Join(err, fmt.Errorf("missing command field for index %d", i))
-		}
-		if job.Time == "" {
-			err = errors.Join(err, fmt.Errorf("missing time field for index %d", i))
-		}
+		err = errors.Join(err, validateJobFields(job, fmt.Sprintf(" for index %d", i)))
+	}
+	return CronTab{Jobs: multiple}, err
+}
+
+func validateJobFields(job CronJob, suffix string) (err error) {
+	if job.Name == "" {
+		err = errors.Join(err, errors.New("missing name field"+suffix))
+	}
+	if job.Command == "" {
+		err = errors.Join(err, errors.New("missing command field"+suffix))
 	}
-	return multiple, err
+	if job.Time == "" {
+		err = errors.Join(err, errors.New("missing time field"+suffix))
+	}
+	return err
 }
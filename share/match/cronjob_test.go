@@ -1,9 +1,19 @@
 package match_test
 
 import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ross96D/updater/logger"
+	"github.com/ross96D/updater/share/configuration"
 	"github.com/ross96D/updater/share/match"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/require"
 )
 
@@ -37,3 +47,328 @@ func TestCreateJobConfigurationData(t *testing.T) {
 		require.Equal(t, input.out, string(data))
 	}
 }
+
+func TestCronTab(t *testing.T) {
+	tab, err := match.ValidateCronJobConfiguration([]byte(`{
+		"user": "www-data",
+		"env": {"PATH": "/usr/bin:/bin", "GREETING": " hello "},
+		"mailto": "",
+		"jobs": [
+			{"name": "first", "command": "echo 1", "time": "*/5 * * * *"},
+			{"name": "second", "command": "echo  2", "time": "@daily", "user": "root"}
+		]
+	}`))
+	require.NoError(t, err)
+	data := string(match.CreateJobConfigurationData(tab))
+	require.Equal(t, `MAILTO=""
+GREETING=" hello "
+PATH=/usr/bin:/bin
+# first
+*/5 * * * * www-data echo 1
+# second
+@daily root echo  2
+`, data)
+
+	invalid := []string{
+		`{"user": "bad user", "jobs": [{"name": "a", "command": "echo", "time": "* * * * *"}]}`,
+		`{"env": {"BAD-NAME": "a"}, "jobs": []}`,
+		`{"env": {"NAME": "a\nb"}, "jobs": []}`,
+		`[{"name": "a", "command": "echo\n* * * * * root rm -rf /", "time": "* * * * *"}]`,
+		`[{"name": "a", "command": "echo", "time": "* * * * *", "user": "a b"}]`,
+	}
+	for _, in := range invalid {
+		_, err = match.ValidateCronJobConfiguration([]byte(in))
+		require.Error(t, err, in)
+	}
+}
+
+func TestCronFileName(t *testing.T) {
+	name, err := match.CronFileName("my.app name")
+	require.NoError(t, err)
+	require.Equal(t, "my_app_name", name)
+
+	_, err = match.CronFileName("..")
+	require.Error(t, err)
+}
+
+type cronData map[string]string
+
+func (d cronData) Clean() {}
+func (d cronData) Get(name string) io.ReadCloser {
+	content, ok := d[name]
+	if !ok {
+		return nil
+	}
+	return io.NopCloser(strings.NewReader(content))
+}
+
+func TestInstallCronJobs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	dir := t.TempDir()
+	backend := match.CurrentCronBackend()
+	match.SetCronBackend(match.CronD{Dir: dir})
+	t.Cleanup(func() { match.SetCronBackend(backend) })
+
+	mailto := "ops@example.com"
+	app := configuration.Application{
+		Name: "cron.app",
+		Cron: &configuration.Cron{
+			User:   "nobody",
+			Env:    map[string]string{"SHELL": "/bin/sh", "MODE": "config"},
+			MailTo: &mailto,
+		},
+	}
+	result := match.Update(
+		logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil),
+		app,
+		match.WithData(cronData{"__jobs": `{"env": {"MODE": "payload"}, "jobs": [{"name": "job", "command": "echo job", "time": "0 1 * * *"}]}`}),
+	)
+	require.True(t, result.IsEmpty())
+
+	info, err := os.Stat(filepath.Join(dir, "cron_app"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	tab, err := match.InstalledCronJobs(app.Name)
+	require.NoError(t, err)
+	require.Equal(t, match.CronTab{
+		Env:    map[string]string{"SHELL": "/bin/sh", "MODE": "payload"},
+		MailTo: &mailto,
+		Jobs:   []match.CronJob{{Name: "job", Command: "echo job", Time: "0 1 * * *", User: "nobody"}},
+	}, tab)
+
+	tab, err = match.InstalledCronJobs("other")
+	require.NoError(t, err)
+	require.Empty(t, tab.Jobs)
+
+	// the files not written by the updater for the app are not replaced
+	system := []byte("0 * * * * root /usr/lib/sysstat/sa1\n")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sysstat"), system, 0644))
+	tab = match.CronTab{Jobs: []match.CronJob{{Name: "job", Command: "echo job", Time: "0 1 * * *", User: "root"}}}
+	require.Error(t, match.CurrentCronBackend().Install("sysstat", tab))
+	data, err := os.ReadFile(filepath.Join(dir, "sysstat"))
+	require.NoError(t, err)
+	require.Equal(t, system, data)
+
+	require.Error(t, match.CurrentCronBackend().Install("cron_app", tab))
+	installed, err := match.InstalledCronJobs(app.Name)
+	require.NoError(t, err)
+	require.Equal(t, "echo job", installed.Jobs[0].Command)
+}
+
+func TestScheduler(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	scheduler, err := match.NewScheduler(dir)
+	require.NoError(t, err)
+
+	tab := match.CronTab{
+		Env:  map[string]string{"VALUE": "scheduled"},
+		Jobs: []match.CronJob{{Name: "job", Command: "echo $VALUE > " + out + "; exit 3", Time: "0 0 1 1 *"}},
+	}
+	require.NoError(t, scheduler.Install("app", tab))
+	require.ErrorIs(t, scheduler.Trigger("app", "other"), match.ErrJobNotFound)
+	require.NoError(t, scheduler.Trigger("app", "job"))
+
+	require.Eventually(t, func() bool {
+		jobs := scheduler.Jobs("app")
+		return len(jobs) == 1 && jobs[0].LastRun != nil
+	}, 5*time.Second, 20*time.Millisecond)
+	jobs := scheduler.Jobs("app")
+	require.Equal(t, 3, jobs[0].LastRun.ExitCode)
+	require.True(t, jobs[0].LastRun.Manual)
+	require.False(t, jobs[0].NextRun.IsZero())
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "scheduled\n", string(data))
+
+	require.NoError(t, scheduler.Pause("app", "job", true))
+	scheduler.Stop()
+
+	scheduler, err = match.NewScheduler(dir)
+	require.NoError(t, err)
+	t.Cleanup(scheduler.Stop)
+	installed, err := scheduler.Installed("app")
+	require.NoError(t, err)
+	require.Equal(t, tab, installed)
+	jobs = scheduler.Jobs("app")
+	require.Len(t, jobs, 1)
+	require.True(t, jobs[0].Paused)
+	require.True(t, jobs[0].NextRun.IsZero())
+	require.NotNil(t, jobs[0].LastRun)
+	require.Equal(t, 3, jobs[0].LastRun.ExitCode)
+	require.Len(t, jobs[0].History, 1)
+}
+
+func TestDiffCronTabs(t *testing.T) {
+	installed := match.CronTab{Jobs: []match.CronJob{
+		{Name: "same", Command: "echo same", Time: "* * * * *", User: "root"},
+		{Name: "changed", Command: "echo old", Time: "* * * * *"},
+		{Name: "removed", Command: "echo removed", Time: "* * * * *"},
+	}}
+	desired := match.CronTab{Jobs: []match.CronJob{
+		{Name: "same", Command: "echo same", Time: "* * * * *"},
+		{Name: "changed", Command: "echo new", Time: "* * * * *"},
+		{Name: "added", Command: "echo added", Time: "* * * * *"},
+	}}
+	diff := match.DiffCronTabs(installed, desired)
+	require.Equal(t, match.CronTabDiff{
+		Added:   []match.CronJob{desired.Jobs[2]},
+		Changed: []match.CronJob{desired.Jobs[1]},
+		Removed: []match.CronJob{installed.Jobs[2]},
+	}, diff)
+
+	require.True(t, match.DiffCronTabs(installed, installed).IsEmpty())
+	installed.Env = map[string]string{"A": "B"}
+	require.True(t, match.DiffCronTabs(installed, match.CronTab{Jobs: installed.Jobs}).Settings)
+}
+
+func TestCronJobsCleanup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	dir := t.TempDir()
+	backend := match.CurrentCronBackend()
+	match.SetCronBackend(match.CronD{Dir: dir})
+	t.Cleanup(func() { match.SetCronBackend(backend) })
+
+	jobs := cronData{"__jobs": `[{"name": "job", "command": "echo job", "time": "0 1 * * *"}]`}
+	ctx := logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil)
+	for _, name := range []string{"kept", "deleted", "deployed"} {
+		result := match.Update(ctx, configuration.Application{Name: name}, match.WithData(jobs))
+		require.True(t, result.IsEmpty())
+	}
+	// files not written by the updater are never removed
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "system"), []byte("* * * * * root true\n"), 0644))
+
+	apps, err := match.CurrentCronBackend().Apps()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"kept", "deleted", "deployed"}, apps)
+
+	// a deploy without __jobs removes the jobs
+	result := match.Update(ctx, configuration.Application{Name: "deployed"}, match.WithData(cronData{}))
+	require.True(t, result.IsEmpty())
+	require.NoFileExists(t, filepath.Join(dir, "deployed"))
+
+	require.NoError(t, match.CleanupCronJobs(&log.Logger, []string{"kept", "system"}))
+	require.FileExists(t, filepath.Join(dir, "kept"))
+	require.FileExists(t, filepath.Join(dir, "system"))
+	require.NoFileExists(t, filepath.Join(dir, "deleted"))
+}
+
+func TestMigrateCronJobs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	crond := match.CronD{Dir: t.TempDir()}
+	tab := match.CronTab{Jobs: []match.CronJob{{Name: "job", Command: "echo job", Time: "0 1 * * *", User: "root"}}}
+	require.NoError(t, crond.Install("kept", tab))
+	require.NoError(t, crond.Install("deleted", tab))
+	system := filepath.Join(crond.Dir, "system")
+	require.NoError(t, os.WriteFile(system, []byte("* * * * * root true\n"), 0644))
+
+	scheduler, err := match.NewScheduler(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(scheduler.Stop)
+
+	require.NoError(t, match.MigrateCronJobs(&log.Logger, crond, scheduler, []string{"kept"}))
+	apps, err := crond.Apps()
+	require.NoError(t, err)
+	require.Empty(t, apps)
+	require.FileExists(t, system)
+
+	apps, err = scheduler.Apps()
+	require.NoError(t, err)
+	require.Equal(t, []string{"kept"}, apps)
+	installed, err := scheduler.Installed("kept")
+	require.NoError(t, err)
+	require.Equal(t, tab.Jobs, installed.Jobs)
+}
+
+func TestCronToOnCalendar(t *testing.T) {
+	inputs := []struct {
+		in  string
+		out []string
+	}{
+		{in: "@daily", out: []string{"daily"}},
+		{in: "* * * * *", out: []string{"*-*-* *:*:00"}},
+		{in: "*/15 3 * * *", out: []string{"*-*-* 3:0,15,30,45:00"}},
+		{in: "0 9-11 * jan,Jul 1-5", out: []string{"Mon,Tue,Wed,Thu,Fri *-1,7-* 9,10,11:0:00"}},
+		{in: "30 2 1 * 0,7", out: []string{"*-*-1 2:30:00", "Sun *-*-* 2:30:00"}},
+		{in: "0 0 */10 * *", out: []string{"*-*-1,11,21,31 0:0:00"}},
+	}
+	for _, input := range inputs {
+		t.Run(input.in, func(t *testing.T) {
+			out, err := match.CronToOnCalendar(input.in)
+			require.NoError(t, err)
+			require.Equal(t, input.out, out)
+		})
+	}
+	for _, invalid := range []string{"@reboot", "0 0 L * *", "60 * * * *", "* * *"} {
+		_, err := match.CronToOnCalendar(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestSystemdTimers(t *testing.T) {
+	dir := t.TempDir()
+	calls := []string{}
+	backend := match.SystemdTimers{Dir: dir, Systemctl: func(args ...string) error {
+		calls = append(calls, strings.Join(args, " "))
+		return nil
+	}}
+
+	mailto := "ops@example.com"
+	tab := match.CronTab{
+		Env:    map[string]string{"GREETING": "100% done"},
+		MailTo: &mailto,
+		Jobs: []match.CronJob{
+			{Name: "report", Command: `echo "$GREETING"`, Time: "0 3 * * *"},
+			{Name: "cleanup", Command: "rm -rf /tmp/app", Time: "@hourly", User: "nobody"},
+		},
+	}
+	require.NoError(t, backend.Install("my.app", tab))
+	require.Equal(t, []string{
+		"daemon-reload",
+		"enable updater-my_app-cleanup.timer", "restart updater-my_app-cleanup.timer",
+		"enable updater-my_app-report.timer", "restart updater-my_app-report.timer",
+	}, calls)
+
+	service, err := os.ReadFile(filepath.Join(dir, "updater-my_app-report.service"))
+	require.NoError(t, err)
+	require.Contains(t, string(service), "User=root\n")
+	require.Contains(t, string(service), "Environment=\"GREETING=100%% done\"\n")
+	require.Contains(t, string(service), "ExecStart=/bin/sh -c \"echo \\\"$$GREETING\\\"\"\n")
+	timer, err := os.ReadFile(filepath.Join(dir, "updater-my_app-report.timer"))
+	require.NoError(t, err)
+	require.Contains(t, string(timer), "OnCalendar=*-*-* 3:0:00\n")
+
+	installed, err := backend.Installed("my.app")
+	require.NoError(t, err)
+	require.ElementsMatch(t, tab.Jobs, installed.Jobs)
+	require.Equal(t, tab.Env, installed.Env)
+	require.Equal(t, tab.MailTo, installed.MailTo)
+	require.False(t, match.DiffCronTabs(installed, tab).Settings)
+	apps, err := backend.Apps()
+	require.NoError(t, err)
+	require.Equal(t, []string{"my.app"}, apps)
+
+	calls = calls[:0]
+	require.NoError(t, backend.Install("my.app", tab))
+	require.Empty(t, calls)
+
+	tab.Jobs = tab.Jobs[:1]
+	require.NoError(t, backend.Install("my.app", tab))
+	require.Equal(t, []string{"disable --now updater-my_app-cleanup.timer", "daemon-reload"}, calls)
+	require.NoFileExists(t, filepath.Join(dir, "updater-my_app-cleanup.service"))
+
+	require.NoError(t, backend.Remove("my.app"))
+	apps, err = backend.Apps()
+	require.NoError(t, err)
+	require.Empty(t, apps)
+}
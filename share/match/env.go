@@ -0,0 +1,149 @@
+package match
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ross96D/updater/share/configuration"
+)
+
+const maskedValue = "******"
+
+// secrets shorter than this are only masked when they are the whole value of a variable
+const minSecretLength = 4
+
+// commandEnv returns the enviroment of the command. In increasing precedence it has the updater variables
+// allowed by inherit_env, the identity variables, the env files in order and the env of the command.
+// secrets are the values loaded from the env files
+func commandEnv(command configuration.Command, id identity) (env []string, secrets []string, err error) {
+	vars := inheritedEnv(command.InheritEnv)
+	for k, v := range id.env() {
+		vars[k] = v
+	}
+	for _, path := range command.EnvFile {
+		fileVars, err := readEnvFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for k, v := range fileVars {
+			vars[k] = v
+			secrets = append(secrets, v)
+		}
+	}
+	for k, v := range command.Env {
+		vars[k] = v
+	}
+	env = parseEnvMap(vars)
+	slices.Sort(env)
+	return env, secrets, nil
+}
+
+// envFileSecrets returns the values of the env files of the command, files that can not be read are ignored
+func envFileSecrets(command configuration.Command) (secrets []string) {
+	for _, path := range command.EnvFile {
+		vars, err := readEnvFile(path)
+		if err != nil {
+			continue
+		}
+		for _, v := range vars {
+			secrets = append(secrets, v)
+		}
+	}
+	return secrets
+}
+
+func inheritedEnv(inherit configuration.InheritEnv) map[string]string {
+	vars := make(map[string]string)
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if inherit == nil || slices.Contains(inherit, k) {
+			vars[k] = v
+		}
+	}
+	return vars
+}
+
+func readEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("env file %w", err)
+	}
+	defer f.Close()
+	vars, err := parseEnvFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("env file %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// parseEnvFile parses the dotenv format: KEY=value lines, optionally prefixed by export.
+// Empty lines and lines starting with # are ignored. Values can be single quoted (literal)
+// or double quoted (supports \n, \t, \" and \\ escapes), unquoted values end at a " #" comment
+func parseEnvFile(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		key, value, found := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=value", line)
+		}
+		value = strings.TrimSpace(value)
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			value = unquoted
+		default:
+			if index := strings.Index(value, " #"); index >= 0 {
+				value = strings.TrimSpace(value[:index])
+			}
+		}
+		vars[key] = value
+	}
+	return vars, scanner.Err()
+}
+
+// maskSecrets replaces the secrets found on text
+func maskSecrets(text string, secrets []string) string {
+	for _, secret := range secrets {
+		if len(secret) < minSecretLength {
+			continue
+		}
+		text = strings.ReplaceAll(text, secret, maskedValue)
+	}
+	return text
+}
+
+// envString returns the variables of env that are not inherited from the updater
+// as a KEY=value list with the secrets masked
+func envString(env []string, secrets []string) string {
+	result := make([]string, 0, len(env))
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		if inherited, ok := os.LookupEnv(k); ok && inherited == v {
+			continue
+		}
+		if v != "" && slices.Contains(secrets, v) {
+			v = maskedValue
+		}
+		result = append(result, k+"="+maskSecrets(v, secrets))
+	}
+	return strings.Join(result, " ")
+}
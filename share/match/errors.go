@@ -1,6 +1,7 @@
 package match
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 
@@ -32,6 +33,7 @@ type ErrError struct{ err error }
 
 func (e ErrError) Error() string { return e.err.Error() }
 func (e ErrError) Level() string { return "error" }
+func (e ErrError) Unwrap() error { return e.err }
 func (e ErrError) Log(logger *zerolog.Logger) {
 	logger.Error().Err(e.err).Send()
 }
@@ -40,6 +42,7 @@ type ErrWarning struct{ err error }
 
 func (e ErrWarning) Error() string { return e.err.Error() }
 func (e ErrWarning) Level() string { return "warning" }
+func (e ErrWarning) Unwrap() error { return e.err }
 func (e ErrWarning) Log(logger *zerolog.Logger) {
 	logger.Warn().Err(e.err).Send()
 }
@@ -54,11 +57,7 @@ func (e JoinErrors) IsEmpty() bool {
 
 func (e JoinErrors) LevelIsError() bool {
 	for _, err := range e.errs {
-		if err, ok := err.(ErrLevel); ok {
-			if err.Error() == "error" {
-				return true
-			}
-		} else {
+		if err.Level() == "error" {
 			return true
 		}
 	}
@@ -81,6 +80,16 @@ func (e *JoinErrors) Add(err error) {
 	}
 }
 
+// Contains reports whether any of the errors matches target, see errors.Is
+func (e JoinErrors) Contains(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 func (v *JoinErrors) Concat(err JoinErrors) {
 	for _, er := range err.errs {
 		v.Add(er)
@@ -0,0 +1,88 @@
+package match
+
+import (
+	"fmt"
+	"os/user"
+	"strings"
+
+	"github.com/ross96D/updater/share/configuration"
+)
+
+// identity is the user and group a command runs as. A nil user or group
+// means that the one of the updater process is used
+type identity struct {
+	user  *user.User
+	group *user.Group
+}
+
+func lookupIdentity(command configuration.Command) (id identity, err error) {
+	if command.User != "" {
+		if id.user, err = user.Lookup(command.User); err != nil {
+			return id, fmt.Errorf("lookup user %s: %w", command.User, err)
+		}
+	}
+	if command.Group != "" {
+		if id.group, err = user.LookupGroup(command.Group); err != nil {
+			return id, fmt.Errorf("lookup group %s: %w", command.Group, err)
+		}
+	}
+	return id, nil
+}
+
+func (id identity) isZero() bool {
+	return id.user == nil && id.group == nil
+}
+
+// env returns the enviroment variables that identify the user for the command
+func (id identity) env() map[string]string {
+	if id.user == nil {
+		return nil
+	}
+	return map[string]string{
+		"HOME":    id.user.HomeDir,
+		"USER":    id.user.Username,
+		"LOGNAME": id.user.Username,
+	}
+}
+
+func (id identity) String() string {
+	var username, group string
+	if id.user != nil {
+		username = id.user.Username
+	} else if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+	if id.group != nil {
+		group = id.group.Name
+	} else if id.user != nil {
+		if g, err := user.LookupGroupId(id.user.Gid); err == nil {
+			group = g.Name
+		}
+	} else if current, err := user.Current(); err == nil {
+		if g, err := user.LookupGroupId(current.Gid); err == nil {
+			group = g.Name
+		}
+	}
+	return strings.TrimSuffix(username+":"+group, ":")
+}
+
+// limitsScript returns the shell statements that set the umask and resource limits of the command
+func limitsScript(command configuration.Command) string {
+	statements := make([]string, 0, 4)
+	if command.Umask != "" {
+		statements = append(statements, "umask "+command.Umask)
+	}
+	if limits := command.Limits; limits != nil {
+		if limits.CPU > 0 {
+			statements = append(statements, fmt.Sprintf("ulimit -t %d", limits.CPU))
+		}
+		if limits.AddressSpace > 0 {
+			// ulimit -v uses kibibytes
+			statements = append(statements, fmt.Sprintf("ulimit -v %d", (limits.AddressSpace+1023)/1024))
+		}
+		if limits.OpenFiles > 0 {
+			statements = append(statements, fmt.Sprintf("ulimit -n %d", limits.OpenFiles))
+		}
+	}
+	return strings.Join(statements, " && ")
+}
@@ -1,9 +1,12 @@
 package match
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/ross96D/updater/share/configuration"
 	"github.com/ross96D/updater/share/utils"
@@ -12,32 +15,101 @@ import (
 )
 
 type IO interface {
-	RunCommand(*zerolog.Logger, configuration.Command) error
+	RunCommand(context.Context, *zerolog.Logger, configuration.Command) (CommandResult, error)
 	Unzip(string) error
-	ServiceStart(string, taskservice.ServiceType) error
-	ServiceStop(string, taskservice.ServiceType) error
+	ServiceStart(string, taskservice.Config) error
+	ServiceStop(string, taskservice.Config) error
+	ServiceRestart(string, taskservice.Config) error
+	ServiceReload(string, taskservice.Config) error
+	DaemonReload(taskservice.Config) error
+	ServiceEnable(string, taskservice.Config) error
+	ServiceWaitReady(context.Context, string, taskservice.Config, time.Duration) error
+	ServiceJournal(name string, config taskservice.Config, since time.Time, lines int) ([]string, error)
+	ContainerDeploy(ctx context.Context, name string, container configuration.Container, archive string, startTimeout time.Duration) error
 	CopyFromReader(io.Reader, string) error
 	RenameSafe(string, string) error
 	Remove(string) error
-	CreateCronjobConfiguration(serviceName string, jobs []cronJob) error
+	CreateCronjobConfiguration(appName string, tab CronTab) error
+	RemoveCronjobConfiguration(appName string) error
 }
 
 type implIO struct{}
 
-func (implIO) RunCommand(logger *zerolog.Logger, command configuration.Command) error {
-	return RunCommand(logger, command)
+func (implIO) RunCommand(ctx context.Context, logger *zerolog.Logger, command configuration.Command) (CommandResult, error) {
+	return RunCommandContext(ctx, logger, command)
 }
 
 func (implIO) Unzip(path string) error {
 	return utils.Unzip(path)
 }
 
-func (i implIO) ServiceStart(name string, st taskservice.ServiceType) error {
-	return taskservice.NewService(st).Start(name)
+func (i implIO) ServiceStart(name string, st taskservice.Config) error {
+	return taskservice.New(st).Start(name)
 }
 
-func (i implIO) ServiceStop(name string, st taskservice.ServiceType) error {
-	return taskservice.NewService(st).Stop(name)
+func (i implIO) ServiceStop(name string, st taskservice.Config) error {
+	return taskservice.New(st).Stop(name)
+}
+
+func (i implIO) ServiceRestart(name string, st taskservice.Config) error {
+	return taskservice.New(st).Restart(name)
+}
+
+func (i implIO) ServiceReload(name string, st taskservice.Config) error {
+	return taskservice.New(st).Reload(name)
+}
+
+func (i implIO) DaemonReload(st taskservice.Config) error {
+	manager, err := unitManager(st)
+	if err != nil {
+		return err
+	}
+	return manager.DaemonReload()
+}
+
+func (i implIO) ServiceEnable(name string, st taskservice.Config) error {
+	manager, err := unitManager(st)
+	if err != nil {
+		return err
+	}
+	return manager.Enable(name)
+}
+
+// ServiceWaitReady waits for the services of the linux service managers, the windows ones do not report
+// when they are ready
+func (i implIO) ServiceWaitReady(ctx context.Context, name string, st taskservice.Config, timeout time.Duration) error {
+	if st.Type == taskservice.NNSM || st.Type == taskservice.TaskSched {
+		return nil
+	}
+	return taskservice.WaitReady(ctx, taskservice.New(st), name, timeout, serviceSettleWindow)
+}
+
+func (i implIO) ServiceJournal(name string, st taskservice.Config, since time.Time, lines int) ([]string, error) {
+	journal, ok := taskservice.New(st).(taskservice.Journal)
+	if !ok {
+		return nil, fmt.Errorf("the journal is %w by the service type %s", taskservice.ErrNotSupported, st.Type)
+	}
+	return journal.Journal(name, since, lines)
+}
+
+func (i implIO) ContainerDeploy(ctx context.Context, name string, container configuration.Container, archive string, startTimeout time.Duration) error {
+	spec := taskservice.ContainerSpec{
+		Name:    name,
+		Image:   container.Image,
+		Ports:   container.Ports,
+		Volumes: container.Volumes,
+		Env:     container.Env,
+		Args:    container.Args,
+	}
+	return taskservice.ContainerService{Runtime: container.Runtime}.Deploy(ctx, spec, archive, startTimeout, serviceSettleWindow)
+}
+
+func unitManager(st taskservice.Config) (taskservice.UnitManager, error) {
+	manager, ok := taskservice.New(st).(taskservice.UnitManager)
+	if !ok {
+		return nil, fmt.Errorf("unit files are %w by the service type %s", taskservice.ErrNotSupported, st.Type)
+	}
+	return manager, nil
 }
 
 func (implIO) CopyFromReader(reader io.Reader, dst string) error {
@@ -52,35 +124,89 @@ func (implIO) Remove(path string) error {
 	return os.Remove(path)
 }
 
-func (implIO) CreateCronjobConfiguration(serviceName string, jobs []cronJob) error {
-	return createCronjobConfiguration(serviceName, jobs)
+func (implIO) CreateCronjobConfiguration(appName string, tab CronTab) error {
+	return CurrentCronBackend().Install(appName, tab)
+}
+
+func (implIO) RemoveCronjobConfiguration(appName string) error {
+	return CurrentCronBackend().Remove(appName)
 }
 
 type dryRunIO struct{}
 
-func (dryRunIO) RunCommand(logger *zerolog.Logger, command configuration.Command) error {
+func (dryRunIO) RunCommand(_ context.Context, logger *zerolog.Logger, command configuration.Command) (CommandResult, error) {
 	cmd := exec.Command(command.Command, command.Args...)
 	if command.Path != "" {
 		cmd.Path = command.Path
 	}
-	logger.Info().Msg("running post command " + cmd.String())
-	logger.Info().Msg("success post command " + cmd.String())
+	secrets := envFileSecrets(command)
+	name := maskSecrets(cmd.String(), secrets)
+	if command.Script != "" {
+		name = maskSecrets(command.String(), secrets)
+	}
+	result := CommandResult{Command: maskSecrets(command.String(), secrets)}
+	id, err := lookupIdentity(command)
+	if err != nil {
+		logger.Error().Err(err).Msg("command " + name)
+		return result, ErrError{err}
+	}
+	env, secrets, err := commandEnv(command, id)
+	if err != nil {
+		logger.Error().Err(err).Msg("command " + name)
+		return result, ErrError{err}
+	}
+	logger.Info().Str("identity", id.String()).Str("env", envString(env, secrets)).Msg("running command " + name)
+	if command.Script != "" {
+		logger.Info().Msg("script:\n" + maskSecrets(command.Script, secrets))
+	}
+	if script := limitsScript(command); script != "" {
+		logger.Info().Msg("with limits " + script)
+	}
+	logger.Info().Msg("success command " + name)
 
-	return nil
+	return result, nil
 }
 
 func (dryRunIO) Unzip(_ string) error {
 	return nil
 }
 
-func (dryRunIO) ServiceStart(_ string, _ taskservice.ServiceType) error {
+func (dryRunIO) ServiceStart(_ string, _ taskservice.Config) error {
+	return nil
+}
+
+func (dryRunIO) ServiceStop(_ string, _ taskservice.Config) error {
+	return nil
+}
+
+func (dryRunIO) ServiceRestart(_ string, _ taskservice.Config) error {
+	return nil
+}
+
+func (dryRunIO) ServiceReload(_ string, _ taskservice.Config) error {
+	return nil
+}
+
+func (dryRunIO) DaemonReload(_ taskservice.Config) error {
 	return nil
 }
 
-func (dryRunIO) ServiceStop(_ string, _ taskservice.ServiceType) error {
+func (dryRunIO) ServiceEnable(_ string, _ taskservice.Config) error {
 	return nil
 }
 
+func (dryRunIO) ContainerDeploy(_ context.Context, _ string, _ configuration.Container, _ string, _ time.Duration) error {
+	return nil
+}
+
+func (dryRunIO) ServiceWaitReady(_ context.Context, _ string, _ taskservice.Config, _ time.Duration) error {
+	return nil
+}
+
+func (dryRunIO) ServiceJournal(_ string, _ taskservice.Config, _ time.Time, _ int) ([]string, error) {
+	return nil, nil
+}
+
 func (dryRunIO) CopyFromReader(_ io.Reader, _ string) error {
 	return nil
 }
@@ -93,6 +219,10 @@ func (dryRunIO) Remove(_ string) error {
 	return nil
 }
 
-func (dryRunIO) CreateCronjobConfiguration(serviceName string, jobs []cronJob) error {
+func (dryRunIO) CreateCronjobConfiguration(appName string, tab CronTab) error {
+	return nil
+}
+
+func (dryRunIO) RemoveCronjobConfiguration(appName string) error {
 	return nil
 }
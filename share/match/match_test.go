@@ -1,8 +1,14 @@
 package match_test
 
 import (
+	"bytes"
+	"context"
 	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/ross96D/updater/share/configuration"
 	"github.com/ross96D/updater/share/match"
@@ -21,3 +27,282 @@ func TestCommand(t *testing.T) {
 	})
 	require.NoError(t, err)
 }
+
+func TestExpandCommand(t *testing.T) {
+	vars := match.CommandVars{
+		App:       configuration.Application{Name: "app"},
+		Asset:     configuration.Asset{Name: "asset", SystemPath: "/usr/bin/app"},
+		Release:   match.Release{Tag: "v1.2.3"},
+		RequestID: "request",
+		DryRun:    true,
+	}
+	command, err := match.ExpandCommand(configuration.Command{
+		Command: "echo",
+		Args:    []string{"{{.App.Name}}", "{{.Asset.SystemPath}}", "{{.Release.Tag}}"},
+		Path:    "/srv/{{.App.Name}}",
+		Env: map[string]string{
+			"REQUEST":         "{{.RequestID}}-{{.DryRun}}",
+			"UPDATER_DRY_RUN": "overwritten",
+		},
+	}, vars)
+	require.NoError(t, err)
+	require.Equal(t, []string{"app", "/usr/bin/app", "v1.2.3"}, command.Args)
+	require.Equal(t, "/srv/app", command.Path)
+	require.Equal(t, "request-true", command.Env["REQUEST"])
+	require.Equal(t, "overwritten", command.Env["UPDATER_DRY_RUN"])
+	require.Equal(t, "v1.2.3", command.Env["UPDATER_RELEASE_TAG"])
+	require.Equal(t, "/usr/bin/app", command.Env["UPDATER_ASSET_SYSTEM_PATH"])
+
+	_, err = match.ExpandCommand(configuration.Command{Command: "echo", Args: []string{"{{.Unknown}}"}}, vars)
+	require.Error(t, err)
+}
+
+func TestCommandTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	logger := zerolog.Nop()
+
+	start := time.Now()
+	err := match.RunCommand(&logger, configuration.Command{
+		Command: "sh",
+		Args:    []string{"-c", "sleep 10 & sleep 10"},
+		Timeout: configuration.Duration(100 * time.Millisecond),
+	})
+	require.ErrorIs(t, err, match.ErrCommandTimeout)
+	require.Equal(t, "error", err.(match.ErrLevel).Level())
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// the command ignores SIGTERM so it must be killed after the grace period
+	start = time.Now()
+	err = match.RunCommand(&logger, configuration.Command{
+		Command:   "sh",
+		Args:      []string{"-c", "trap '' TERM; sleep 10"},
+		Timeout:   configuration.Duration(100 * time.Millisecond),
+		KillGrace: configuration.Duration(200 * time.Millisecond),
+	})
+	require.ErrorIs(t, err, match.ErrCommandTimeout)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestCommandIdentityAndLimits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	buff := &bytes.Buffer{}
+	logger := zerolog.New(buff)
+
+	err := match.RunCommand(&logger, configuration.Command{
+		Command: "sh",
+		Args:    []string{"-c", "umask; ulimit -n"},
+		Umask:   "027",
+		Limits:  &configuration.Limits{OpenFiles: 64},
+	})
+	require.NoError(t, err)
+	require.Contains(t, buff.String(), `"message":"0027"`)
+	require.Contains(t, buff.String(), `"message":"64"`)
+
+	if os.Getuid() != 0 {
+		return
+	}
+	if _, err := user.Lookup("nobody"); err != nil {
+		return
+	}
+	buff.Reset()
+	err = match.RunCommand(&logger, configuration.Command{
+		Command: "id",
+		Args:    []string{"-un"},
+		User:    "nobody",
+	})
+	require.NoError(t, err)
+	require.Contains(t, buff.String(), `"message":"nobody"`)
+}
+
+func TestCommandRetriesAndExitCodes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	logger := zerolog.Nop()
+	failing := configuration.Command{
+		Command:      "sh",
+		Args:         []string{"-c", "exit 3"},
+		Retries:      2,
+		RetryBackoff: configuration.Duration(time.Millisecond),
+	}
+
+	result, err := match.RunCommandWithResult(&logger, failing)
+	require.Error(t, err)
+	require.Equal(t, "error", err.(match.ErrLevel).Level())
+	require.Len(t, result.Attempts, 3)
+	for i, attempt := range result.Attempts {
+		require.Equal(t, i+1, attempt.Attempt)
+		require.Equal(t, 3, attempt.ExitCode)
+		require.NotEmpty(t, attempt.Error)
+	}
+
+	failing.OnFailure = "warning"
+	_, err = match.RunCommandWithResult(&logger, failing)
+	require.Error(t, err)
+	require.Equal(t, "warning", err.(match.ErrLevel).Level())
+
+	failing.OnFailure = "ignore"
+	_, err = match.RunCommandWithResult(&logger, failing)
+	require.NoError(t, err)
+
+	failing.OnFailure = ""
+	failing.AllowedExitCodes = []int{3}
+	result, err = match.RunCommandWithResult(&logger, failing)
+	require.NoError(t, err)
+	require.Len(t, result.Attempts, 1)
+	require.Equal(t, 3, result.Attempts[0].ExitCode)
+
+	counter := filepath.Join(t.TempDir(), "counter")
+	result, err = match.RunCommandWithResult(&logger, configuration.Command{
+		Command:      "sh",
+		Args:         []string{"-c", `n=$(cat "$0" 2>/dev/null || echo 0); n=$((n+1)); echo $n > "$0"; [ $n -ge 2 ]`, counter},
+		Retries:      3,
+		RetryBackoff: configuration.Duration(time.Millisecond),
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Attempts, 2)
+	require.Equal(t, 1, result.Attempts[0].ExitCode)
+	require.Equal(t, 0, result.Attempts[1].ExitCode)
+}
+
+func TestCommandScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	buff := &bytes.Buffer{}
+	logger := zerolog.New(buff)
+
+	err := match.RunCommand(&logger, configuration.Command{
+		Script: "echo \"first $1\"\necho \"second $ENV_VALUE\" >&2\n",
+		Args:   []string{"argument"},
+		Env:    map[string]string{"ENV_VALUE": "env"},
+	})
+	require.NoError(t, err)
+	require.Contains(t, buff.String(), `"message":"first argument"`)
+	require.Contains(t, buff.String(), `"message":"second env"`)
+
+	// strict mode fails on unset variables and failing pipes
+	err = match.RunCommand(&logger, configuration.Command{Script: "echo $UNSET_UPDATER_VARIABLE"})
+	require.Error(t, err)
+	err = match.RunCommand(&logger, configuration.Command{Script: "false | true"})
+	require.Error(t, err)
+
+	strict := false
+	err = match.RunCommand(&logger, configuration.Command{Script: "false | true", Strict: &strict})
+	require.NoError(t, err)
+
+	buff.Reset()
+	err = match.RunCommand(&logger, configuration.Command{
+		Script:      "echo posix",
+		Interpreter: "sh",
+	})
+	require.NoError(t, err)
+	require.Contains(t, buff.String(), `"message":"posix"`)
+}
+
+func TestCommandEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	t.Setenv("UPDATER_TEST_INHERITED", "inherited")
+	t.Setenv("UPDATER_TEST_ALLOWED", "allowed")
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	err := os.WriteFile(envFile, []byte(
+		"# comment\n"+
+			"export FILE_VALUE=from_file\n"+
+			"OVERRIDDEN=from_file\n"+
+			"QUOTED=\"line1\\nline2\"\n"+
+			"SECRET='super-secret-value'\n",
+	), 0o600)
+	require.NoError(t, err)
+
+	buff := &bytes.Buffer{}
+	logger := zerolog.New(buff)
+
+	err = match.RunCommand(&logger, configuration.Command{
+		Script:  "echo \"$FILE_VALUE $OVERRIDDEN ${UPDATER_TEST_INHERITED:-none}\"\necho \"$QUOTED\"\n",
+		Args:    []string{"super-secret-value"},
+		EnvFile: configuration.StringList{envFile},
+		Env:     map[string]string{"OVERRIDDEN": "from_env"},
+	})
+	require.NoError(t, err)
+	require.Contains(t, buff.String(), `"message":"from_file from_env inherited"`)
+	require.Contains(t, buff.String(), `"message":"line2"`)
+	require.NotContains(t, buff.String(), "super-secret-value")
+
+	buff.Reset()
+	err = match.RunCommand(&logger, configuration.Command{
+		Script:     "echo \"${UPDATER_TEST_INHERITED:-none} ${UPDATER_TEST_ALLOWED:-none}\"",
+		InheritEnv: configuration.InheritEnv{"UPDATER_TEST_ALLOWED"},
+	})
+	require.NoError(t, err)
+	require.Contains(t, buff.String(), `"message":"none allowed"`)
+
+	buff.Reset()
+	err = match.RunCommand(&logger, configuration.Command{
+		Script:     "echo \"${UPDATER_TEST_INHERITED:-none} ${UPDATER_TEST_ALLOWED:-none}\"",
+		InheritEnv: configuration.InheritEnv{},
+	})
+	require.NoError(t, err)
+	require.Contains(t, buff.String(), `"message":"none none"`)
+
+	err = match.RunCommand(&logger, configuration.Command{
+		Command: "true",
+		EnvFile: configuration.StringList{filepath.Join(dir, "missing.env")},
+	})
+	require.Error(t, err)
+}
+
+func TestCommandCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	buff := &bytes.Buffer{}
+	logger := zerolog.New(buff)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	result, err := match.RunCommandContext(ctx, &logger, configuration.Command{
+		Command:   "sleep",
+		Args:      []string{"10"},
+		Retries:   3,
+		OnFailure: "ignore",
+	})
+	require.Error(t, err)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Len(t, result.Attempts, 1)
+}
+
+func TestCommandOutputTail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	buff := &bytes.Buffer{}
+	logger := zerolog.New(buff)
+
+	result, err := match.RunCommandWithResult(&logger, configuration.Command{
+		Script: "for i in $(seq 1 60); do echo \"out $i\"; echo \"err $i\" >&2; done\nexit 3\n",
+	})
+	require.Error(t, err)
+	require.Contains(t, buff.String(), `"level":"warn","pipe":"stderr"`)
+	require.Contains(t, buff.String(), `"level":"info","pipe":"stdout"`)
+
+	require.Equal(t, 3, result.ExitCode)
+	require.Greater(t, result.Duration, time.Duration(0))
+	require.Len(t, result.Attempts, 1)
+	attempt := result.Attempts[0]
+	require.Len(t, attempt.Stdout, 50)
+	require.Len(t, attempt.Stderr, 50)
+	require.Equal(t, "out 11", attempt.Stdout[0].Text)
+	require.Equal(t, "err 60", attempt.Stderr[49].Text)
+	require.False(t, attempt.Stderr[49].Time.IsZero())
+}
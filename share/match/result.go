@@ -0,0 +1,28 @@
+package match
+
+// Result of an application update
+type Result struct {
+	JoinErrors
+	ID       string          `json:"id"`
+	Status   UpdateStatus    `json:"status"`
+	Commands []CommandResult `json:"commands"`
+	// operations on the app level services, in the order they were done
+	Services []ServiceResult `json:"services,omitempty"`
+	// output of the services that failed to start
+	ServiceLogs []ServiceLog `json:"service_logs,omitempty"`
+}
+
+// ServiceLog is the end of the journal of a service that failed to start or to be ready,
+// since the start of the update
+type ServiceLog struct {
+	Service string   `json:"service"`
+	Lines   []string `json:"lines"`
+}
+
+// ServiceResult is an operation of an update on an app level service: stop, start, restart, reload or deploy.
+// Error is empty if it succeeded
+type ServiceResult struct {
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+	Error     string `json:"error,omitempty"`
+}
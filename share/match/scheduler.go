@@ -0,0 +1,391 @@
+package match
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adhocore/gronx"
+	"github.com/ross96D/updater/share/configuration"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrJobNotFound is returned by the Scheduler when the application does not have a job with the given name
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobRunning is returned by Scheduler.Trigger when the job is still running
+var ErrJobRunning = errors.New("job is already running")
+
+// number of runs kept on the history of a job
+const maxJobHistory = 20
+
+// JobRun is a run of a job of the Scheduler
+type JobRun struct {
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	ExitCode  int           `json:"exit_code"`
+	Error     string        `json:"error,omitempty"`
+	Manual    bool          `json:"manual"`
+}
+
+// JobStatus is the state of a job of the Scheduler
+type JobStatus struct {
+	CronJob
+	Paused  bool      `json:"paused"`
+	Running bool      `json:"running"`
+	NextRun time.Time `json:"next_run,omitzero"`
+	LastRun *JobRun   `json:"last_run,omitempty"`
+	History []JobRun  `json:"history"`
+}
+
+type scheduledJob struct {
+	job     CronJob
+	paused  bool
+	running bool
+	history []JobRun
+}
+
+type scheduledApp struct {
+	tab  CronTab
+	jobs []*scheduledJob
+}
+
+// storedApp is the file where the Scheduler keeps the jobs of an application
+type storedApp struct {
+	App     string              `json:"app"`
+	Tab     CronTab             `json:"tab"`
+	Paused  []string            `json:"paused"`
+	History map[string][]JobRun `json:"history,omitempty"`
+}
+
+// Scheduler runs the jobs of the applications inside the updater.
+// The jobs and their history are stored on dir, one json file per application, so they survive a restart
+type Scheduler struct {
+	dir    string
+	logger zerolog.Logger
+
+	mut  sync.Mutex
+	apps map[string]*scheduledApp
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// NewScheduler loads the jobs stored on dir and starts running them
+func NewScheduler(dir string) (*Scheduler, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("scheduler directory %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Scheduler{
+		dir:    dir,
+		logger: log.Logger.With().Str("scheduler", "builtin").Logger(),
+		apps:   make(map[string]*scheduledApp),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("scheduler directory %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		name, app, err := s.load(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			s.logger.Error().Err(err).Msgf("loading jobs from %s", entry.Name())
+			continue
+		}
+		s.apps[name] = app
+	}
+
+	s.running.Add(1)
+	go s.loop()
+	return s, nil
+}
+
+func (s *Scheduler) load(path string) (name string, app *scheduledApp, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	var stored storedApp
+	if err = json.Unmarshal(data, &stored); err != nil {
+		return "", nil, err
+	}
+	if stored.App == "" {
+		return "", nil, errors.New("missing app name")
+	}
+	app = &scheduledApp{tab: stored.Tab}
+	for _, job := range stored.Tab.Jobs {
+		app.jobs = append(app.jobs, &scheduledJob{
+			job:     job,
+			paused:  slices.Contains(stored.Paused, job.Name),
+			history: stored.History[job.Name],
+		})
+	}
+	return stored.App, app, nil
+}
+
+func (s *Scheduler) path(app string) (string, error) {
+	name, err := CronFileName(app)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, name+".json"), nil
+}
+
+// store writes the jobs of the application, the caller must hold the lock
+func (s *Scheduler) store(app string) error {
+	path, err := s.path(app)
+	if err != nil {
+		return err
+	}
+	scheduled := s.apps[app]
+	stored := storedApp{App: app, Tab: scheduled.tab, Paused: []string{}, History: map[string][]JobRun{}}
+	for _, job := range scheduled.jobs {
+		if job.paused {
+			stored.Paused = append(stored.Paused, job.job.Name)
+		}
+		if len(job.history) > 0 {
+			stored.History[job.job.Name] = job.history
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// Stop stops scheduling jobs, the running ones are cancelled
+func (s *Scheduler) Stop() {
+	s.cancel()
+	s.running.Wait()
+}
+
+func (s *Scheduler) loop() {
+	defer s.running.Done()
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.runDue(next)
+	}
+}
+
+// runDue starts the jobs that are due at ref and are not paused or still running
+func (s *Scheduler) runDue(ref time.Time) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	gron := gronx.New()
+	for name, app := range s.apps {
+		for _, job := range app.jobs {
+			if job.paused {
+				continue
+			}
+			due, err := gron.IsDue(job.job.Time, ref)
+			if err != nil || !due {
+				continue
+			}
+			if job.running {
+				s.logger.Warn().Str("app", name).Str("job", job.job.Name).Msg("skipping job, the previous run is still running")
+				continue
+			}
+			s.start(name, app.tab, job, false)
+		}
+	}
+}
+
+// start runs the job on a new goroutine, the caller must hold the lock
+func (s *Scheduler) start(app string, tab CronTab, job *scheduledJob, manual bool) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	job.running = true
+	name := job.job.Name
+	shell, args := shellCommand(job.job.Command)
+	command := configuration.Command{
+		Command: shell,
+		Args:    args,
+		Env:     tab.Env,
+		User:    job.job.User,
+	}
+	logger := s.logger.With().Str("app", app).Str("job", name).Logger()
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		logger.Info().Bool("manual", manual).Msgf("running job %s", name)
+		run := JobRun{StartedAt: time.Now(), Manual: manual}
+		result, err := RunCommandContext(s.ctx, &logger, command)
+		run.Duration = result.Duration
+		run.ExitCode = result.ExitCode
+		if err != nil {
+			run.Error = err.Error()
+		}
+
+		s.mut.Lock()
+		defer s.mut.Unlock()
+		job.running = false
+		job.history = append(job.history, run)
+		if len(job.history) > maxJobHistory {
+			job.history = slices.Delete(job.history, 0, len(job.history)-maxJobHistory)
+		}
+		// the job could have been removed while it was running
+		if scheduled, ok := s.apps[app]; ok && slices.Contains(scheduled.jobs, job) {
+			if err := s.store(app); err != nil {
+				logger.Error().Err(err).Msgf("storing the history of job %s", name)
+			}
+		}
+	}()
+}
+
+// Install replaces the jobs of the application. The history and paused state of the jobs
+// that keep the same name are preserved
+func (s *Scheduler) Install(app string, tab CronTab) error {
+	if app == "" {
+		return errors.New("scheduler Install() app name is empty")
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	previous := make(map[string]*scheduledJob)
+	if scheduled, ok := s.apps[app]; ok {
+		for _, job := range scheduled.jobs {
+			previous[job.job.Name] = job
+		}
+	}
+	scheduled := &scheduledApp{tab: tab}
+	for _, job := range tab.Jobs {
+		if old, ok := previous[job.Name]; ok {
+			old.job = job
+			scheduled.jobs = append(scheduled.jobs, old)
+		} else {
+			scheduled.jobs = append(scheduled.jobs, &scheduledJob{job: job})
+		}
+	}
+	s.apps[app] = scheduled
+	return s.store(app)
+}
+
+func (s *Scheduler) Installed(app string) (CronTab, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	scheduled, ok := s.apps[app]
+	if !ok {
+		return CronTab{Jobs: []CronJob{}}, nil
+	}
+	return scheduled.tab, nil
+}
+
+// Remove removes the jobs of the application, the running ones are not stopped
+func (s *Scheduler) Remove(app string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if _, ok := s.apps[app]; !ok {
+		return nil
+	}
+	path, err := s.path(app)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	delete(s.apps, app)
+	return nil
+}
+
+func (s *Scheduler) Apps() ([]string, error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return slices.Sorted(maps.Keys(s.apps)), nil
+}
+
+// Jobs returns the state of the jobs of the application
+func (s *Scheduler) Jobs(app string) []JobStatus {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	scheduled, ok := s.apps[app]
+	if !ok {
+		return []JobStatus{}
+	}
+	result := make([]JobStatus, 0, len(scheduled.jobs))
+	for _, job := range scheduled.jobs {
+		status := JobStatus{
+			CronJob: job.job,
+			Paused:  job.paused,
+			Running: job.running,
+			History: slices.Clone(job.history),
+		}
+		if len(job.history) > 0 {
+			last := job.history[len(job.history)-1]
+			status.LastRun = &last
+		}
+		if !job.paused {
+			status.NextRun, _ = gronx.NextTick(job.job.Time, false)
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+// find returns the job of the application, the caller must hold the lock
+func (s *Scheduler) find(app string, name string) (*scheduledApp, *scheduledJob, error) {
+	scheduled, ok := s.apps[app]
+	if !ok {
+		return nil, nil, ErrJobNotFound
+	}
+	for _, job := range scheduled.jobs {
+		if job.job.Name == name {
+			return scheduled, job, nil
+		}
+	}
+	return nil, nil, ErrJobNotFound
+}
+
+// Trigger runs the job now, even if it is paused
+func (s *Scheduler) Trigger(app string, name string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	scheduled, job, err := s.find(app, name)
+	if err != nil {
+		return err
+	}
+	if job.running {
+		return fmt.Errorf("%s: %w", name, ErrJobRunning)
+	}
+	s.start(app, scheduled.tab, job, true)
+	return nil
+}
+
+// Pause stops or resumes the scheduling of the job
+func (s *Scheduler) Pause(app string, name string, paused bool) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	_, job, err := s.find(app, name)
+	if err != nil {
+		return err
+	}
+	job.paused = paused
+	return s.store(app)
+}
@@ -0,0 +1,44 @@
+package match
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ross96D/updater/share/configuration"
+)
+
+// strictMode returns the statement that enables the strict mode of the interpreter,
+// empty if the interpreter is not a known shell
+func strictMode(interpreter string) string {
+	switch filepath.Base(interpreter) {
+	case "bash", "zsh", "ksh":
+		return "set -euo pipefail\n"
+	case "sh", "dash", "ash":
+		// posix shells do not support pipefail
+		return "set -eu\n"
+	default:
+		return ""
+	}
+}
+
+// writeScript writes the command script to a temporary file that is passed to the interpreter
+func writeScript(command configuration.Command) (path string, err error) {
+	file, err := os.CreateTemp("", "__updater_script_")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	path = file.Name()
+
+	if command.Strict == nil || *command.Strict {
+		if _, err = file.WriteString(strictMode(command.InterpreterOrDefault())); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+	}
+	if _, err = file.WriteString(command.Script); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
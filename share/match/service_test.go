@@ -0,0 +1,477 @@
+package match_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ross96D/updater/logger"
+	"github.com/ross96D/updater/share/configuration"
+	"github.com/ross96D/updater/share/match"
+	taskservice "github.com/ross96D/updater/task_service"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+// serviceIO records the service operations and copies nothing
+type serviceIO struct {
+	match.IO
+	mut   sync.Mutex
+	calls []string
+	// operations that fail
+	fail map[string]bool
+}
+
+// recordService records a service operation, the ones of user services end with --user
+func (s *serviceIO) recordService(op string, config taskservice.Config) error {
+	if config.Scope == taskservice.ScopeUser {
+		op += " --user"
+	}
+	return s.record(op)
+}
+
+func (s *serviceIO) record(op string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.calls = append(s.calls, op)
+	if s.fail[op] {
+		return fmt.Errorf("%s failed", op)
+	}
+	return nil
+}
+
+func (s *serviceIO) ServiceStart(name string, config taskservice.Config) error {
+	return s.recordService("start "+name, config)
+}
+func (s *serviceIO) ServiceStop(name string, config taskservice.Config) error {
+	return s.recordService("stop "+name, config)
+}
+func (s *serviceIO) ServiceRestart(name string, config taskservice.Config) error {
+	return s.recordService("restart "+name, config)
+}
+func (s *serviceIO) ServiceReload(name string, config taskservice.Config) error {
+	return s.recordService("reload "+name, config)
+}
+func (s *serviceIO) DaemonReload(config taskservice.Config) error {
+	return s.recordService("daemon-reload", config)
+}
+func (s *serviceIO) ServiceEnable(name string, config taskservice.Config) error {
+	return s.recordService("enable "+name, config)
+}
+func (s *serviceIO) ServiceWaitReady(_ context.Context, name string, config taskservice.Config, _ time.Duration) error {
+	return s.recordService("wait "+name, config)
+}
+func (s *serviceIO) ServiceJournal(name string, config taskservice.Config, _ time.Time, _ int) ([]string, error) {
+	if err := s.recordService("journal "+name, config); err != nil {
+		return nil, err
+	}
+	return []string{name + ": failed to bind port"}, nil
+}
+func (s *serviceIO) RunCommand(_ context.Context, _ *zerolog.Logger, command configuration.Command) (match.CommandResult, error) {
+	return match.CommandResult{Command: command.Command}, s.record("run " + command.Command)
+}
+func (s *serviceIO) CopyFromReader(_ io.Reader, dst string) error {
+	return s.record("copy " + dst)
+}
+func (s *serviceIO) RenameSafe(string, string) error { return nil }
+func (s *serviceIO) Remove(string) error             { return nil }
+
+func TestServiceAction(t *testing.T) {
+	asset := func(action string) configuration.Application {
+		app := configuration.Application{
+			Name: "service_action_app",
+			Assets: []configuration.Asset{
+				{Name: "bin", SystemPath: "/opt/app/bin", Service: "app.service", ServiceAction: action},
+			},
+		}
+		app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+		return app
+	}
+	ctx := logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil)
+	data := cronData{"bin": "binary"}
+
+	inputs := []struct {
+		app   configuration.Application
+		calls []string
+	}{
+		{app: asset(""), calls: []string{"stop app.service", "copy /opt/app/bin", "start app.service", "wait app.service"}},
+		{app: asset("stop-start"), calls: []string{"stop app.service", "copy /opt/app/bin", "start app.service", "wait app.service"}},
+		{app: asset("restart"), calls: []string{"copy /opt/app/bin", "restart app.service", "wait app.service"}},
+		{app: asset("reload"), calls: []string{"copy /opt/app/bin", "reload app.service"}},
+		{app: asset("none"), calls: []string{"copy /opt/app/bin"}},
+	}
+	for _, input := range inputs {
+		t.Run(input.app.Assets[0].ServiceAction, func(t *testing.T) {
+			recorder := &serviceIO{}
+			result := match.Update(ctx, input.app, match.WithData(data), match.WithIO(recorder))
+			require.True(t, result.IsEmpty())
+			require.Equal(t, input.calls, recorder.calls)
+		})
+	}
+
+	t.Run("app level reload", func(t *testing.T) {
+		app := asset("none")
+		app.Service = "app-level.service"
+		app.ServiceAction = "reload"
+		recorder := &serviceIO{}
+		result := match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+		require.True(t, result.IsEmpty())
+		require.Equal(t, []string{"copy /opt/app/bin", "reload app-level.service"}, recorder.calls)
+	})
+
+	t.Run("user scope", func(t *testing.T) {
+		app := asset("")
+		app.Assets[0].ServiceScope = "user"
+		app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+		recorder := &serviceIO{}
+		result := match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+		require.True(t, result.IsEmpty())
+		require.Equal(t, []string{"stop app.service --user", "copy /opt/app/bin", "start app.service --user", "wait app.service --user"}, recorder.calls)
+	})
+}
+
+func TestAppServicesOrder(t *testing.T) {
+	app := configuration.Application{
+		Name: "services_app",
+		Services: []configuration.Service{
+			{Name: "web.service"},
+			{Name: "worker.service", Action: "restart"},
+			{Name: "scheduler.service"},
+		},
+		Assets: []configuration.Asset{{Name: "bin", SystemPath: "/opt/app/bin"}},
+	}
+	app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+	ctx := logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil)
+	data := cronData{"bin": "binary"}
+
+	recorder := &serviceIO{}
+	result := match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.IsEmpty())
+	require.Equal(t, []string{
+		"stop web.service", "stop scheduler.service", "copy /opt/app/bin",
+		"start scheduler.service", "wait scheduler.service",
+		"restart worker.service", "wait worker.service",
+		"start web.service", "wait web.service",
+	}, recorder.calls)
+
+	// a failed start does not stop the start of the other services and is reported on his service
+	recorder = &serviceIO{fail: map[string]bool{"stop scheduler.service": true, "start scheduler.service": true}}
+	result = match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.LevelIsError())
+	require.Equal(t, []match.ServiceResult{
+		{Service: "web.service", Operation: "stop"},
+		{Service: "scheduler.service", Operation: "stop", Error: "stop scheduler.service failed"},
+		{Service: "scheduler.service", Operation: "start", Error: "start scheduler.service failed"},
+		{Service: "worker.service", Operation: "restart"},
+		{Service: "web.service", Operation: "start"},
+	}, result.Services)
+}
+
+func TestUnitFileAsset(t *testing.T) {
+	app := configuration.Application{
+		Name: "unit_file_app",
+		Assets: []configuration.Asset{
+			{Name: "unit", SystemPath: "/etc/systemd/system/app.service", Service: "app.service", ServiceAction: "restart", UnitFile: true},
+		},
+	}
+	app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+	ctx := logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil)
+	data := cronData{"unit": "[Unit]"}
+
+	recorder := &serviceIO{}
+	result := match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.IsEmpty())
+	require.Equal(t, []string{
+		"copy /etc/systemd/system/app.service", "daemon-reload", "enable app.service", "restart app.service", "wait app.service",
+	}, recorder.calls)
+
+	// a unit that can not be enabled is rolled back and the service is not restarted
+	recorder = &serviceIO{fail: map[string]bool{"enable app.service": true}}
+	result = match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.LevelIsError())
+	require.Equal(t, []string{
+		"copy /etc/systemd/system/app.service", "daemon-reload", "enable app.service", "daemon-reload",
+	}, recorder.calls)
+}
+
+// commandIO runs the commands and records the removed files
+type commandIO struct {
+	*serviceIO
+}
+
+func (c commandIO) RunCommand(ctx context.Context, logger *zerolog.Logger, command configuration.Command) (match.CommandResult, error) {
+	return match.RunCommandContext(ctx, logger, command)
+}
+func (c commandIO) Remove(path string) error { return c.record("remove " + path) }
+
+func TestAssetCommandWarning(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	failing := func(onFailure string) *configuration.Command {
+		return &configuration.Command{Command: "sh", Args: []string{"-c", "exit 1"}, OnFailure: onFailure}
+	}
+	app := func(onFailure string) configuration.Application {
+		app := configuration.Application{
+			Name: "asset_command_warning_app",
+			Assets: []configuration.Asset{
+				{Name: "bin", SystemPath: "/opt/app/bin", CommandPre: failing(onFailure), Command: failing(onFailure)},
+			},
+		}
+		app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+		return app
+	}
+	ctx := logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil)
+	data := cronData{"bin": "binary"}
+
+	// the warnings are reported and the asset is copied and his old file removed
+	recorder := commandIO{&serviceIO{}}
+	result := match.Update(ctx, app("warning"), match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.IsNotEmpty())
+	require.False(t, result.LevelIsError())
+	require.Len(t, result.Commands, 2)
+	require.Equal(t, []string{"copy /opt/app/bin", "remove /opt/app/bin.old"}, recorder.calls)
+
+	// an error on the pre command stops the copy
+	recorder = commandIO{&serviceIO{}}
+	result = match.Update(ctx, app("error"), match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.LevelIsError())
+	require.Len(t, result.Commands, 1)
+	require.Empty(t, recorder.calls)
+}
+
+func TestServiceNotReady(t *testing.T) {
+	app := configuration.Application{
+		Name:    "not_ready_app",
+		Service: "app.service",
+		Assets: []configuration.Asset{
+			{Name: "bin", SystemPath: "/opt/app/bin", Service: "asset.service"},
+		},
+	}
+	app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+	ctx := logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil)
+
+	recorder := &serviceIO{fail: map[string]bool{"wait asset.service": true}}
+	result := match.Update(ctx, app, match.WithData(cronData{"bin": "binary"}), match.WithIO(recorder))
+	require.True(t, result.LevelIsError())
+	require.Contains(t, recorder.calls, "journal asset.service")
+	require.Equal(t, []match.ServiceLog{
+		{Service: "asset.service", Lines: []string{"asset.service: failed to bind port"}},
+	}, result.ServiceLogs)
+
+	// the journal is also attached when the start fails
+	recorder = &serviceIO{fail: map[string]bool{"start app.service": true}}
+	result = match.Update(ctx, app, match.WithData(cronData{"bin": "binary"}), match.WithIO(recorder))
+	require.True(t, result.LevelIsError())
+	require.Equal(t, []match.ServiceLog{
+		{Service: "app.service", Lines: []string{"app.service: failed to bind port"}},
+	}, result.ServiceLogs)
+
+	// a zero start_timeout disables the wait
+	zero := configuration.Duration(0)
+	app.StartTimeout = &zero
+	app.Assets[0].StartTimeout = &zero
+	app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+	recorder = &serviceIO{fail: map[string]bool{"wait asset.service": true}}
+	result = match.Update(ctx, app, match.WithData(cronData{"bin": "binary"}), match.WithIO(recorder))
+	require.True(t, result.IsEmpty())
+	require.Equal(t, []string{
+		"stop app.service", "stop asset.service", "copy /opt/app/bin", "start asset.service", "start app.service",
+	}, recorder.calls)
+}
+
+// fakeDocker puts on PATH a docker cli that logs his arguments, has a running container
+// and fails to run the image failImage
+func fakeDocker(t *testing.T, failImage string) (logPath string) {
+	dir := t.TempDir()
+	logPath = filepath.Join(dir, "log")
+	script := `#!/bin/sh
+echo "$@" >> "` + logPath + `"
+case "$1 $2 $4" in
+"container inspect {{.Image}}") echo sha256:old ;;
+"container inspect "*) echo "running 42 0 2024-01-01T00:00:00Z" ;;
+"run "*) for arg in "$@"; do [ "$arg" = "` + failImage + `" ] && exit 1; done ;;
+esac
+exit 0
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logPath
+}
+
+func TestContainerService(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	ctx := logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil)
+	zero := configuration.Duration(0)
+	container := &configuration.Container{
+		Runtime: "docker",
+		Image:   "registry.local/web:2",
+		Ports:   []string{"8080:80"},
+		Env:     map[string]string{"A": "B"},
+		Args:    []string{"serve"},
+	}
+
+	t.Run("load", func(t *testing.T) {
+		logPath := fakeDocker(t, "")
+		archive := filepath.Join(t.TempDir(), "image.tar")
+		loaded := *container
+		loaded.Load = true
+		app := configuration.Application{
+			Name: "container_app",
+			Assets: []configuration.Asset{{
+				Name: "image", SystemPath: archive, Service: "web", ServiceType: "container", Container: &loaded, StartTimeout: &zero,
+			}},
+		}
+		app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+		result := match.Update(ctx, app, match.WithData(cronData{"image": "tarball"}))
+		require.True(t, result.IsEmpty())
+
+		data, err := os.ReadFile(logPath)
+		require.NoError(t, err)
+		require.Equal(t, strings.Join([]string{
+			"load --input " + archive,
+			"container inspect --format {{.Image}} web",
+			"tag sha256:old registry.local/web:updater-previous",
+			"stop web",
+			"rm web",
+			"run --detach --name web --publish 8080:80 --env A=B registry.local/web:2 serve",
+		}, "\n")+"\n", string(data))
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		logPath := fakeDocker(t, "registry.local/web:2")
+		app := configuration.Application{
+			Name: "container_app", Service: "web", ServiceType: "container", Container: container, StartTimeout: &zero,
+		}
+		result := match.Update(ctx, app, match.WithData(cronData{}))
+		require.True(t, result.LevelIsError())
+
+		data, err := os.ReadFile(logPath)
+		require.NoError(t, err)
+		require.Equal(t, strings.Join([]string{
+			"pull registry.local/web:2",
+			"container inspect --format {{.Image}} web",
+			"tag sha256:old registry.local/web:updater-previous",
+			"stop web",
+			"rm web",
+			"run --detach --name web --publish 8080:80 --env A=B registry.local/web:2 serve",
+			"stop web",
+			"rm web",
+			"run --detach --name web --publish 8080:80 --env A=B registry.local/web:updater-previous serve",
+		}, "\n")+"\n", string(data))
+	})
+}
+
+func TestBlueGreen(t *testing.T) {
+	releaseDir := t.TempDir()
+	app := configuration.Application{
+		Name: "blue_green_app",
+		BlueGreen: &configuration.BlueGreen{
+			Service:     "app@.service",
+			ReleaseDir:  releaseDir,
+			HealthCheck: &configuration.Command{Command: "check {{.Color}}"},
+			Switch:      &configuration.Command{Command: "switch {{.Color}}"},
+		},
+		Assets: []configuration.Asset{{Name: "bin", SystemPath: "bin"}},
+	}
+	app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+	ctx := logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil)
+	data := cronData{"bin": "binary"}
+	bin := func(color string) string { return "copy " + filepath.Join(releaseDir, color, "bin") }
+	activeColor := func() string {
+		color, err := match.ActiveColor(*app.BlueGreen)
+		require.NoError(t, err)
+		return color
+	}
+
+	// the first deploy goes to blue and there is nothing to stop
+	recorder := &serviceIO{}
+	result := match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.IsEmpty())
+	require.Equal(t, []string{
+		bin("blue"), "restart app@blue.service", "wait app@blue.service", "run check blue", "run switch blue",
+	}, recorder.calls)
+	require.Equal(t, match.ColorBlue, activeColor())
+	// the configuration keeps the relative paths
+	require.Equal(t, "bin", app.Assets[0].SystemPath)
+
+	recorder = &serviceIO{}
+	result = match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.IsEmpty())
+	require.Equal(t, []string{
+		bin("green"), "restart app@green.service", "wait app@green.service", "run check green", "run switch green",
+		"stop app@blue.service",
+	}, recorder.calls)
+	require.Equal(t, match.ColorGreen, activeColor())
+
+	// the idle directory starts as a copy of the active release, so the assets missing on the update keep
+	// the active version
+	require.NoError(t, os.WriteFile(filepath.Join(releaseDir, "green", "conf"), []byte("green conf"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(releaseDir, "blue", "stale"), []byte("stale"), 0644))
+
+	// an unhealthy instance is stopped and the traffic stays on green
+	recorder = &serviceIO{fail: map[string]bool{"run check blue": true}}
+	result = match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.LevelIsError())
+	require.Equal(t, []string{
+		bin("blue"), "restart app@blue.service", "wait app@blue.service", "run check blue", "stop app@blue.service",
+	}, recorder.calls)
+	require.Equal(t, match.ColorGreen, activeColor())
+	conf, err := os.ReadFile(filepath.Join(releaseDir, "blue", "conf"))
+	require.NoError(t, err)
+	require.Equal(t, "green conf", string(conf))
+	require.NoFileExists(t, filepath.Join(releaseDir, "blue", "stale"))
+
+	// a failed switch switches the traffic back
+	recorder = &serviceIO{fail: map[string]bool{"run switch blue": true}}
+	result = match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.LevelIsError())
+	require.Equal(t, []string{
+		bin("blue"), "restart app@blue.service", "wait app@blue.service", "run check blue", "run switch blue",
+		"run switch green", "stop app@blue.service",
+	}, recorder.calls)
+	require.Equal(t, match.ColorGreen, activeColor())
+
+	// the release of blue failed, it is not rolled back to
+	recorder = &serviceIO{}
+	result = match.Rollback(ctx, app, match.WithIO(recorder))
+	require.True(t, result.Contains(match.ErrNoPreviousColor))
+	require.Empty(t, recorder.calls)
+	require.Equal(t, match.ColorGreen, activeColor())
+
+	recorder = &serviceIO{}
+	result = match.Update(ctx, app, match.WithData(data), match.WithIO(recorder))
+	require.True(t, result.IsEmpty())
+	require.Equal(t, match.ColorBlue, activeColor())
+
+	// the rollback switches to the release of the previous color, that served the traffic
+	recorder = &serviceIO{}
+	result = match.Rollback(ctx, app, match.WithIO(recorder))
+	require.True(t, result.IsEmpty())
+	require.Equal(t, []string{
+		"restart app@green.service", "wait app@green.service", "run check green", "run switch green", "stop app@blue.service",
+	}, recorder.calls)
+	require.Equal(t, match.ColorGreen, activeColor())
+
+	// a previous release that is not healthy is discarded
+	recorder = &serviceIO{fail: map[string]bool{"run check blue": true}}
+	result = match.Rollback(ctx, app, match.WithIO(recorder))
+	require.True(t, result.LevelIsError())
+	require.Equal(t, match.ColorGreen, activeColor())
+	result = match.Rollback(ctx, app, match.WithIO(&serviceIO{}))
+	require.True(t, result.Contains(match.ErrNoPreviousColor))
+
+	app.BlueGreen = nil
+	result = match.Rollback(ctx, app, match.WithIO(&serviceIO{}))
+	require.True(t, result.Contains(match.ErrNotBlueGreen))
+}
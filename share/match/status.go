@@ -0,0 +1,105 @@
+package match
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ross96D/updater/share/configuration"
+	taskservice "github.com/ross96D/updater/task_service"
+)
+
+// ServiceStatus is the state of a service of an application, Asset is empty for the app level service
+type ServiceStatus struct {
+	Name  string `json:"name"`
+	Asset string `json:"asset,omitempty"`
+	taskservice.Status
+	Error string `json:"error,omitempty"`
+}
+
+// AssetStatus is the metadata of the deployed file of an asset
+type AssetStatus struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Exists  bool      `json:"exists"`
+	Size    int64     `json:"size,omitempty"`
+	Mode    string    `json:"mode,omitempty"`
+	ModTime time.Time `json:"mod_time,omitzero"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// AppStatus is the state of the services and deployed files of an application and the outcome of his last update
+type AppStatus struct {
+	App      string          `json:"app"`
+	Services []ServiceStatus `json:"services"`
+	Assets   []AssetStatus   `json:"assets"`
+	// the color that serves the traffic of a blue/green app
+	ActiveColor string      `json:"active_color,omitempty"`
+	LastUpdate  *UpdateInfo `json:"last_update,omitempty"`
+}
+
+// GetAppStatus queries the app level and per asset services and stats the deployed files.
+// A service that can not be queried has the error set instead of failing the whole status
+func GetAppStatus(app configuration.Application) AppStatus {
+	status := AppStatus{
+		App:      app.Name,
+		Services: []ServiceStatus{},
+		Assets:   make([]AssetStatus, 0, len(app.Assets)),
+	}
+	for _, service := range app.AppServices() {
+		status.Services = append(status.Services, serviceStatus(service.Name, serviceConfig(service.Type, service.Scope, service.User, service.Container), ""))
+	}
+	assetsDir := ""
+	if bg := app.BlueGreen; bg != nil {
+		// the assets of a blue/green app are the ones of the active color, blue before the first deploy
+		status.ActiveColor, _ = ActiveColor(*bg)
+		assetsDir = colorDir(*bg, ColorBlue)
+		if status.ActiveColor != "" {
+			assetsDir = colorDir(*bg, status.ActiveColor)
+		}
+		for _, color := range []string{ColorBlue, ColorGreen} {
+			status.Services = append(status.Services, serviceStatus(colorInstance(bg.Service, color), serviceConfig(bg.Type, bg.Scope, bg.User, nil), ""))
+		}
+	}
+	for _, asset := range app.Assets {
+		if assetsDir != "" {
+			asset.SystemPath = filepath.Join(assetsDir, asset.SystemPath)
+		}
+		if asset.Service != "" {
+			status.Services = append(status.Services, serviceStatus(asset.Service, serviceConfig(asset.ServiceType, asset.ServiceScope, asset.ServiceUser, asset.Container), asset.Name))
+		}
+		status.Assets = append(status.Assets, assetStatus(asset))
+	}
+	if info, ok := updates.last(app.Name); ok {
+		status.LastUpdate = &info
+	}
+	return status
+}
+
+func serviceStatus(name string, config taskservice.Config, asset string) ServiceStatus {
+	status := ServiceStatus{Name: name, Asset: asset}
+	var err error
+	status.Status, err = taskservice.New(config).Status(name)
+	if err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func assetStatus(asset configuration.Asset) AssetStatus {
+	status := AssetStatus{Name: asset.Name, Path: asset.SystemPath}
+	info, err := os.Stat(asset.SystemPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return status
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Exists = true
+	status.Size = info.Size()
+	status.Mode = info.Mode().String()
+	status.ModTime = info.ModTime()
+	return status
+}
@@ -0,0 +1,412 @@
+package match
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const DefaultSystemdUnitDir = "/etc/systemd/system"
+
+// prefix of the units written by SystemdTimers
+const systemdUnitPrefix = "updater-"
+
+// systemdJobHeader is the line of the service units with the job as json, used to read back the installed jobs
+const systemdJobHeader = "# updater job: "
+
+// SystemdTimers installs each job as a pair of .service and .timer units on Dir.
+// The cron expression of the job is translated to OnCalendar. MAILTO is ignored, the output goes to the journal
+type SystemdTimers struct {
+	Dir string
+	// Systemctl runs systemctl with the arguments, if nil the systemctl binary is used
+	Systemctl func(args ...string) error
+}
+
+// systemdJob is the metadata stored on the service unit of a job. MailTo is not used by the units,
+// it is kept so the installed tab compares equal to the configured one
+type systemdJob struct {
+	CronJob
+	Env    map[string]string `json:"env,omitempty"`
+	MailTo *string           `json:"mailto,omitempty"`
+}
+
+func (s SystemdTimers) systemctl(args ...string) error {
+	if s.Systemctl != nil {
+		return s.Systemctl(args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s %s %w", strings.Join(args, " "), strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// unitName returns the name, without extension, of the units of the job
+func (s SystemdTimers) unitName(app string, job string) (string, error) {
+	appName, err := CronFileName(app)
+	if err != nil {
+		return "", err
+	}
+	jobName, err := CronFileName(job)
+	if err != nil {
+		return "", fmt.Errorf("the job name %q is not valid for a systemd unit", job)
+	}
+	return systemdUnitPrefix + appName + "-" + jobName, nil
+}
+
+// units returns the content of the units of the tab by file name
+func (s SystemdTimers) units(app string, tab CronTab) (map[string][]byte, error) {
+	units := make(map[string][]byte)
+	var err error
+	for _, job := range tab.Jobs {
+		name, errName := s.unitName(app, job.Name)
+		if errName != nil {
+			err = errors.Join(err, errName)
+			continue
+		}
+		calendar, errCalendar := CronToOnCalendar(job.Time)
+		if errCalendar != nil {
+			err = errors.Join(err, fmt.Errorf("%s: %w", job.Name, errCalendar))
+			continue
+		}
+		if _, ok := units[name+".service"]; ok {
+			err = errors.Join(err, fmt.Errorf("%s: another job has the same unit name %s", job.Name, name))
+			continue
+		}
+		units[name+".service"] = systemdServiceUnit(app, tab, job)
+		units[name+".timer"] = systemdTimerUnit(app, job, calendar)
+	}
+	return units, err
+}
+
+func systemdServiceUnit(app string, tab CronTab, job CronJob) []byte {
+	user := job.User
+	if user == "" {
+		user = tab.User
+	}
+	if user == "" {
+		user = defaultCronUser
+	}
+	metadata, _ := json.Marshal(systemdJob{CronJob: job, Env: tab.Env, MailTo: tab.MailTo})
+
+	builder := bytes.Buffer{}
+	builder.WriteString(cronOwnerHeader + app + "\n")
+	builder.WriteString(systemdJobHeader + string(metadata) + "\n")
+	builder.WriteString("[Unit]\n")
+	builder.WriteString(fmt.Sprintf("Description=%s job of %s\n\n", job.Name, app))
+	builder.WriteString("[Service]\n")
+	builder.WriteString("Type=oneshot\n")
+	builder.WriteString(fmt.Sprintf("User=%s\n", user))
+	for _, k := range slices.Sorted(maps.Keys(tab.Env)) {
+		builder.WriteString(fmt.Sprintf("Environment=%s\n", systemdQuote(k+"="+tab.Env[k])))
+	}
+	// $ is expanded by systemd on ExecStart, the command is left for the shell
+	command := strings.ReplaceAll(job.Command, "$", "$$")
+	builder.WriteString(fmt.Sprintf("ExecStart=/bin/sh -c %s\n", systemdQuote(command)))
+	return builder.Bytes()
+}
+
+func systemdTimerUnit(app string, job CronJob, calendar []string) []byte {
+	builder := bytes.Buffer{}
+	builder.WriteString(cronOwnerHeader + app + "\n")
+	builder.WriteString("[Unit]\n")
+	builder.WriteString(fmt.Sprintf("Description=%s job of %s\n\n", job.Name, app))
+	builder.WriteString("[Timer]\n")
+	for _, c := range calendar {
+		builder.WriteString(fmt.Sprintf("OnCalendar=%s\n", c))
+	}
+	builder.WriteString("\n[Install]\n")
+	builder.WriteString("WantedBy=timers.target\n")
+	return builder.Bytes()
+}
+
+// systemdQuote quotes the value as a single argument, escaping the systemd specifiers
+func systemdQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "%", "%%")
+	return `"` + value + `"`
+}
+
+// owned returns the content of the units of Dir written for the application, or for every application if app is empty
+func (s SystemdTimers) owned(app string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string][]byte{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	units := make(map[string][]byte)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, systemdUnitPrefix) {
+			continue
+		}
+		if ext := filepath.Ext(name); ext != ".service" && ext != ".timer" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.Dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if owner, ok := cronFileOwner(data); ok && (app == "" || owner == app) {
+			units[name] = data
+		}
+	}
+	return units, nil
+}
+
+// Install writes the units of the jobs that changed and removes the ones of the jobs no longer on the tab.
+// Then reloads systemd and enables and restarts the timers that changed
+func (s SystemdTimers) Install(app string, tab CronTab) error {
+	if app == "" {
+		return errors.New("systemd Install() app name is empty")
+	}
+	desired, err := s.units(app, tab)
+	if err != nil {
+		return err
+	}
+	installed, err := s.owned(app)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(installed)) {
+		if _, ok := desired[name]; ok {
+			continue
+		}
+		if filepath.Ext(name) == ".timer" {
+			if err = s.systemctl("disable", "--now", name); err != nil {
+				return err
+			}
+		}
+		if err = os.Remove(filepath.Join(s.Dir, name)); err != nil {
+			return err
+		}
+	}
+
+	changed := []string{}
+	for _, name := range slices.Sorted(maps.Keys(desired)) {
+		if bytes.Equal(installed[name], desired[name]) {
+			continue
+		}
+		if err = writeFileAtomic(filepath.Join(s.Dir, name), desired[name], 0644); err != nil {
+			return err
+		}
+		timer := strings.TrimSuffix(strings.TrimSuffix(name, ".service"), ".timer") + ".timer"
+		if !slices.Contains(changed, timer) {
+			changed = append(changed, timer)
+		}
+	}
+
+	if len(changed) == 0 && len(installed) == len(desired) {
+		return nil
+	}
+	if err = s.systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	for _, timer := range changed {
+		if err = s.systemctl("enable", timer); err != nil {
+			return err
+		}
+		if err = s.systemctl("restart", timer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s SystemdTimers) Installed(app string) (CronTab, error) {
+	tab := CronTab{Jobs: []CronJob{}}
+	if _, err := CronFileName(app); err != nil {
+		return tab, nil
+	}
+	units, err := s.owned(app)
+	if err != nil {
+		return tab, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(units)) {
+		if filepath.Ext(name) != ".service" {
+			continue
+		}
+		for line := range strings.Lines(string(units[name])) {
+			metadata, ok := strings.CutPrefix(strings.TrimSpace(line), systemdJobHeader)
+			if !ok {
+				continue
+			}
+			var job systemdJob
+			if err = json.Unmarshal([]byte(metadata), &job); err != nil {
+				return tab, fmt.Errorf("%s: %w", name, err)
+			}
+			tab.Jobs = append(tab.Jobs, job.CronJob)
+			tab.Env = job.Env
+			tab.MailTo = job.MailTo
+			break
+		}
+	}
+	return tab, nil
+}
+
+func (s SystemdTimers) Remove(app string) error {
+	if _, err := CronFileName(app); err != nil {
+		return nil
+	}
+	return s.Install(app, CronTab{})
+}
+
+func (s SystemdTimers) Apps() ([]string, error) {
+	units, err := s.owned("")
+	if err != nil {
+		return nil, err
+	}
+	var apps []string
+	for _, data := range units {
+		if owner, ok := cronFileOwner(data); ok && !slices.Contains(apps, owner) {
+			apps = append(apps, owner)
+		}
+	}
+	slices.Sort(apps)
+	return apps, nil
+}
+
+var (
+	cronMonthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	cronDayNames = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+	systemdDays  = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"}
+)
+
+// CronToOnCalendar translates a cron expression to systemd OnCalendar values.
+// When both the day of month and the day of week are restricted cron runs the job when any of them match,
+// so two values are returned
+func CronToOnCalendar(expr string) ([]string, error) {
+	switch strings.TrimSpace(expr) {
+	case "@yearly", "@annually":
+		return []string{"yearly"}, nil
+	case "@monthly":
+		return []string{"monthly"}, nil
+	case "@weekly":
+		return []string{"weekly"}, nil
+	case "@daily", "@midnight":
+		return []string{"daily"}, nil
+	case "@hourly":
+		return []string{"hourly"}, nil
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%s is not supported by the systemd backend, it needs 5 fields", expr)
+	}
+	minute, err := cronField(fields[0], 0, 59, nil)
+	if err != nil {
+		return nil, err
+	}
+	hour, err := cronField(fields[1], 0, 23, nil)
+	if err != nil {
+		return nil, err
+	}
+	dom, err := cronField(fields[2], 1, 31, nil)
+	if err != nil {
+		return nil, err
+	}
+	month, err := cronField(fields[3], 1, 12, cronMonthNames)
+	if err != nil {
+		return nil, err
+	}
+	dow, err := cronField(fields[4], 0, 7, cronDayNames)
+	if err != nil {
+		return nil, err
+	}
+	if dow != "*" {
+		days := []string{}
+		for value := range strings.SplitSeq(dow, ",") {
+			n, _ := strconv.Atoi(value)
+			if day := systemdDays[n%7]; !slices.Contains(days, day) {
+				days = append(days, day)
+			}
+		}
+		dow = strings.Join(days, ",")
+	}
+
+	calendar := func(dow string, dom string) string {
+		value := fmt.Sprintf("*-%s-%s %s:%s:00", month, dom, hour, minute)
+		if dow != "*" {
+			value = dow + " " + value
+		}
+		return value
+	}
+	if !strings.HasPrefix(fields[2], "*") && !strings.HasPrefix(fields[4], "*") {
+		return []string{calendar("*", dom), calendar(dow, "*")}, nil
+	}
+	return []string{calendar(dow, dom)}, nil
+}
+
+// cronField returns the values of a cron field as a comma separated list, or * if it has all of them
+func cronField(field string, min int, max int, names map[string]int) (string, error) {
+	if field == "*" {
+		return "*", nil
+	}
+	parse := func(value string) (int, error) {
+		if n, ok := names[strings.ToUpper(value)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%s is not supported by the systemd backend", field)
+		}
+		return n, nil
+	}
+
+	values := []int{}
+	for part := range strings.SplitSeq(field, ",") {
+		base, stepValue, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepValue)
+			if err != nil || step <= 0 {
+				return "", fmt.Errorf("%s is not supported by the systemd backend", field)
+			}
+		}
+		start, end := min, max
+		if base != "*" {
+			from, to, isRange := strings.Cut(base, "-")
+			var err error
+			if start, err = parse(from); err != nil {
+				return "", err
+			}
+			end = start
+			if isRange {
+				if end, err = parse(to); err != nil {
+					return "", err
+				}
+			} else if hasStep {
+				end = max
+			}
+		}
+		if start > end {
+			return "", fmt.Errorf("%s is not supported by the systemd backend", field)
+		}
+		for n := start; n <= end; n += step {
+			if !slices.Contains(values, n) {
+				values = append(values, n)
+			}
+		}
+	}
+	slices.Sort(values)
+	result := make([]string, 0, len(values))
+	for _, n := range values {
+		result = append(result, strconv.Itoa(n))
+	}
+	return strings.Join(result, ","), nil
+}
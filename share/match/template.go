@@ -0,0 +1,100 @@
+package match
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/ross96D/updater/share/configuration"
+)
+
+type Release struct {
+	Tag string
+}
+
+// CommandVars are the variables available to the templates on a command args, path and env.
+// For example {{.App.Name}}, {{.Asset.SystemPath}}, {{.Release.Tag}}, {{.RequestID}} or {{.DryRun}}
+type CommandVars struct {
+	App       configuration.Application
+	Asset     configuration.Asset
+	Release   Release
+	RequestID string
+	DryRun    bool
+	// the color deployed on a blue/green app, or the one that receives the traffic on the switch command
+	Color string
+}
+
+// Env returns the variables as UPDATER_* enviroment variables
+func (vars CommandVars) Env() map[string]string {
+	return map[string]string{
+		"UPDATER_APP_NAME":          vars.App.Name,
+		"UPDATER_ASSET_NAME":        vars.Asset.Name,
+		"UPDATER_ASSET_SYSTEM_PATH": vars.Asset.SystemPath,
+		"UPDATER_RELEASE_TAG":       vars.Release.Tag,
+		"UPDATER_REQUEST_ID":        vars.RequestID,
+		"UPDATER_DRY_RUN":           strconv.FormatBool(vars.DryRun),
+		"UPDATER_COLOR":             vars.Color,
+	}
+}
+
+func expand(text string, vars CommandVars) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	builder := strings.Builder{}
+	if err = tmpl.Execute(&builder, vars); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// ExpandCommand returns a copy of command with the templates on the command, script, interpreter, args, path, env and env_file expanded.
+// The UPDATER_* enviroment variables are added to the env, values from the configuration take precedence
+func ExpandCommand(command configuration.Command, vars CommandVars) (result configuration.Command, err error) {
+	result = command
+	if result.Command, err = expand(command.Command, vars); err != nil {
+		return result, fmt.Errorf("command %s: %w", command.Command, err)
+	}
+	if result.Path, err = expand(command.Path, vars); err != nil {
+		return result, fmt.Errorf("path %s: %w", command.Path, err)
+	}
+	if result.Script, err = expand(command.Script, vars); err != nil {
+		return result, fmt.Errorf("script: %w", err)
+	}
+	if result.Interpreter, err = expand(command.Interpreter, vars); err != nil {
+		return result, fmt.Errorf("interpreter %s: %w", command.Interpreter, err)
+	}
+
+	result.Args = make([]string, 0, len(command.Args))
+	for _, arg := range command.Args {
+		var expanded string
+		if expanded, err = expand(arg, vars); err != nil {
+			return result, fmt.Errorf("arg %s: %w", arg, err)
+		}
+		result.Args = append(result.Args, expanded)
+	}
+
+	result.EnvFile = make(configuration.StringList, 0, len(command.EnvFile))
+	for _, path := range command.EnvFile {
+		var expanded string
+		if expanded, err = expand(path, vars); err != nil {
+			return result, fmt.Errorf("env_file %s: %w", path, err)
+		}
+		result.EnvFile = append(result.EnvFile, expanded)
+	}
+
+	result.Env = vars.Env()
+	for k, v := range command.Env {
+		var expanded string
+		if expanded, err = expand(v, vars); err != nil {
+			return result, fmt.Errorf("env %s: %w", k, err)
+		}
+		result.Env[k] = expanded
+	}
+	return result, nil
+}
@@ -6,12 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/ross96D/updater/logger"
 	"github.com/ross96D/updater/share/configuration"
 	taskservice "github.com/ross96D/updater/task_service"
 	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/hlog"
 )
 
 type Data interface {
@@ -33,84 +38,235 @@ type UpdateOpts func(*appUpdater)
 
 func WithDryRun(dryRun bool) UpdateOpts {
 	return func(au *appUpdater) {
+		au.dryRun = dryRun
 		if dryRun {
 			au.io = dryRunIO{}
 		}
 	}
 }
 
+func WithRelease(release Release) UpdateOpts {
+	return func(au *appUpdater) {
+		au.release = release
+	}
+}
+
 func WithData(data Data) UpdateOpts {
 	return func(au *appUpdater) {
 		au.data = data
 	}
 }
 
-func Update(ctx context.Context, app configuration.Application, opts ...UpdateOpts) (errs JoinErrors) {
+// WithIO replaces the file system and service operations of the update
+func WithIO(io IO) UpdateOpts {
+	return func(au *appUpdater) {
+		au.io = io
+	}
+}
+
+func Update(ctx context.Context, app configuration.Application, opts ...UpdateOpts) (result Result) {
 	u := NewAppUpdater(ctx, app, opts...)
+	u.ctx, result.ID = updates.start(ctx, u.requestID, app.Name, u.dryRun)
+	defer u.finish(&result)
 	defer u.data.Clean()
-
-	if u.app.Service != "" {
-		u.log.Info().Msgf("stoping app level service %s", u.app.Service)
-		err := u.io.ServiceStop(u.app.Service, taskservice.ServiceTypeFrom(app.ServiceType))
-		errs.Add(err)
-		defer func() {
-			u.log.Info().Msgf("starting app level service %s", u.app.Service)
-			errServiceStart := u.io.ServiceStart(u.app.Service, taskservice.ServiceTypeFrom(app.ServiceType))
-			errs.Add(errServiceStart)
-		}()
+	errs := &result.JoinErrors
+
+	// the services are stopped in order and, as the starts are deferred, started in reverse order
+	for _, service := range app.AppServices() {
+		config := serviceConfig(service.Type, service.Scope, service.User, service.Container)
+		switch {
+		case config.Type == taskservice.Container:
+			if service.Action == configuration.ServiceActionNone {
+				break
+			}
+			// the container is replaced at the end of a successful update
+			defer func() {
+				if u.ctx.Err() != nil || errs.LevelIsError() {
+					return
+				}
+				err := u.deployContainer(u.log, service.Name, *service.Container, "", service.StartTimeout)
+				errs.Add(err)
+				u.addServiceResult(service.Name, "deploy", err)
+			}()
+		case service.Action == "" || service.Action == configuration.ServiceActionStopStart:
+			u.log.Info().Msgf("stoping app level service %s", service.Name)
+			err := u.io.ServiceStop(service.Name, config)
+			errs.Add(err)
+			u.addServiceResult(service.Name, "stop", err)
+			defer func() {
+				u.log.Info().Msgf("starting app level service %s", service.Name)
+				err := u.io.ServiceStart(service.Name, config)
+				if err != nil {
+					u.attachJournal(u.log, service.Name, config)
+				} else {
+					err = u.waitReady(u.log, service.Name, config, service.StartTimeout)
+				}
+				errs.Add(err)
+				u.addServiceResult(service.Name, "start", err)
+			}()
+		case service.Action == configuration.ServiceActionRestart || service.Action == configuration.ServiceActionReload:
+			defer func() {
+				if u.ctx.Err() != nil {
+					return
+				}
+				u.log.Info().Msgf("%s app level service %s", service.Action, service.Name)
+				err := u.serviceAction(u.log, service.Name, config, service.Action, service.StartTimeout)
+				errs.Add(err)
+				u.addServiceResult(service.Name, service.Action, err)
+			}()
+		}
 	}
 
-	jobs, err := ValidateCronJobConfiguration(u.getJobContent())
+	jobContent, hasJobs := u.getJobContent()
+	jobs, err := ValidateCronJobConfiguration(jobContent)
 	if err != nil {
 		errs.Add(err)
 		return
 	}
 
+	// a blue/green app is deployed to the idle color
+	activeColor := ""
+	if app.BlueGreen != nil {
+		if activeColor, err = ActiveColor(*app.BlueGreen); err != nil {
+			errs.Add(ErrError{err})
+			return
+		}
+		u.log.Info().Msgf("deploying to %s, the active color is %s", otherColor(activeColor), activeColor)
+		if err = u.deployColor(activeColor, otherColor(activeColor)); err != nil {
+			errs.Add(err)
+			return
+		}
+	}
+
 	err = u.RunPreAction()
 	errs.Add(err)
 
-	err2 := u.UpdateAssets()
-	errs.Concat(err2)
+	if u.ctx.Err() == nil {
+		err2 := u.UpdateAssets()
+		errs.Concat(err2)
+	}
 
-	err = u.RunPostAction()
-	errs.Add(err)
+	if u.ctx.Err() == nil {
+		err = u.RunPostAction()
+		errs.Add(err)
+	}
+
+	if u.ctx.Err() == nil && app.BlueGreen != nil && !errs.LevelIsError() {
+		errs.Add(u.switchColor(activeColor, u.color))
+	}
+
+	if u.ctx.Err() != nil {
+		u.log.Warn().Msg("update cancelled")
+		errs.Add(ErrError{ErrUpdateCancelled})
+		return
+	}
 
 	if !errs.LevelIsError() {
-		u.io.CreateCronjobConfiguration(app.Name, jobs)
+		// a deploy without the __jobs asset removes the jobs of the application
+		if !hasJobs {
+			jobs = CronTab{Jobs: []CronJob{}}
+		}
+		if err = u.syncCronJobs(jobs.withDefaults(app.Cron)); err != nil {
+			u.log.Warn().Err(err).Msg("installing cron jobs")
+			errs.Add(ErrWarning{fmt.Errorf("installing cron jobs %w", err)})
+		}
 	}
 
 	return
 }
 
+// syncCronJobs installs the jobs if they differ from the installed ones, logging every change
+func (u *appUpdater) syncCronJobs(tab CronTab) error {
+	installed, err := InstalledCronJobs(u.app.Name)
+	if err != nil {
+		return err
+	}
+	diff := DiffCronTabs(installed, tab)
+	if len(tab.Jobs) == 0 {
+		// the settings of a tab without jobs are not written
+		diff.Settings = false
+	}
+	if diff.IsEmpty() {
+		return nil
+	}
+	for _, job := range diff.Added {
+		u.log.Info().Str("job", job.Name).Str("time", job.Time).Msg("cron job added")
+	}
+	for _, job := range diff.Changed {
+		u.log.Info().Str("job", job.Name).Str("time", job.Time).Msg("cron job changed")
+	}
+	for _, job := range diff.Removed {
+		u.log.Info().Str("job", job.Name).Msg("cron job removed")
+	}
+	if diff.Settings {
+		u.log.Info().Msg("cron jobs enviroment changed")
+	}
+	if len(tab.Jobs) == 0 {
+		return u.io.RemoveCronjobConfiguration(u.app.Name)
+	}
+	return u.io.CreateCronjobConfiguration(u.app.Name, tab)
+}
+
+// time to wait for a started service to be active, and time that it has to stay active to be ready
+const (
+	defaultStartTimeout = 30 * time.Second
+	serviceSettleWindow = 2 * time.Second
+)
+
 type appUpdater struct {
-	app  configuration.Application
-	log  *zerolog.Logger
-	data Data
-	io   IO
+	ctx       context.Context
+	app       configuration.Application
+	log       *zerolog.Logger
+	data      Data
+	io        IO
+	dryRun    bool
+	release   Release
+	requestID string
+
+	commands    []CommandResult
+	commandsMut sync.Mutex
+
+	// color deployed by the update of a blue/green app
+	color string
+
+	// operations on the app level services, only used by the goroutine of Update
+	serviceResults []ServiceResult
+
+	// start of the update, the service journals are read from it
+	started        time.Time
+	serviceLogs    []ServiceLog
+	serviceLogsMut sync.Mutex
 }
 
-func (u appUpdater) getJobContent() []byte {
+// getJobContent returns the content of the __jobs asset, ok is false if the update does not have it
+func (u *appUpdater) getJobContent() (content []byte, ok bool) {
 	jobReader := u.data.Get("__jobs")
 	if jobReader == nil {
-		return []byte{}
+		return []byte{}, false
 	}
+	defer jobReader.Close()
 	data, err := io.ReadAll(jobReader)
 	if err != nil {
-		return []byte{}
+		return []byte{}, true
 	}
-	return data
+	return data, true
 }
 
-func (u appUpdater) seek(asset configuration.Asset) io.ReadCloser {
+func (u *appUpdater) seek(asset configuration.Asset) io.ReadCloser {
 	return u.data.Get(asset.Name)
 }
 
 func NewAppUpdater(ctx context.Context, app configuration.Application, opts ...UpdateOpts) *appUpdater {
 	l, _ := logger.LoggerCtx_FromContext(ctx)
 	appUpd := &appUpdater{
-		app: app,
-		log: l,
-		io:  implIO{},
+		ctx:     ctx,
+		app:     app,
+		log:     l,
+		io:      implIO{},
+		started: time.Now(),
+	}
+	if id, ok := hlog.IDFromCtx(ctx); ok {
+		appUpd.requestID = id.String()
 	}
 
 	for _, opt := range opts {
@@ -139,14 +295,11 @@ func (u *appUpdater) UpdateAssets() (errs JoinErrors) {
 			err := u.updateTask(logger, asset)
 			append_errors(&err)
 		} else {
-			var fnCopy func() (err error)
-			var err error
-			if fnCopy, err = u.updateAsset(logger, asset); err != nil {
+			if fnCopy, err := u.updateAsset(logger, asset); err != nil {
 				append_errors(nil, err)
 			} else {
-				if err = fnCopy(); err != nil {
-					append_errors(nil, err)
-				}
+				copyErrs := fnCopy()
+				append_errors(&copyErrs)
 			}
 		}
 		wg.Done()
@@ -169,6 +322,10 @@ func (u *appUpdater) UpdateAssets() (errs JoinErrors) {
 	wg.Wait()
 
 	for ; i < len(u.app.AsstesOrder); i++ {
+		if u.ctx.Err() != nil {
+			u.log.Warn().Msgf("update cancelled, skipping %d assets", len(u.app.AsstesOrder)-i)
+			break
+		}
 		asset := u.app.AsstesOrder[i]
 		assetLogger := u.log.With().Logger()
 		assetLogger.UpdateContext(func(c zerolog.Context) zerolog.Context {
@@ -178,14 +335,10 @@ func (u *appUpdater) UpdateAssets() (errs JoinErrors) {
 			err := u.updateTask(assetLogger, asset.Asset)
 			errs.Concat(err)
 		} else {
-			var fnCopy func() (err error)
-			var err error
-			if fnCopy, err = u.updateAsset(assetLogger, asset.Asset); err != nil {
+			if fnCopy, err := u.updateAsset(assetLogger, asset.Asset); err != nil {
 				errs.Add(err)
 			} else {
-				if err = fnCopy(); err != nil {
-					errs.Add(err)
-				}
+				errs.Concat(fnCopy())
 			}
 		}
 	}
@@ -193,44 +346,219 @@ func (u *appUpdater) UpdateAssets() (errs JoinErrors) {
 }
 
 func (u *appUpdater) updateTask(logger zerolog.Logger, asset configuration.Asset) (errs JoinErrors) {
-	var fnCopy func() error
-	var err error
-	if fnCopy, err = u.updateAsset(logger, asset); err != nil {
+	fnCopy, err := u.updateAsset(logger, asset)
+	if err != nil {
 		errs.Add(FmtFromInnerError("updateTask %w", err))
 		return
 	}
 
+	if u.ctx.Err() != nil {
+		logger.Warn().Msgf("update cancelled, skipping %s", asset.Name)
+		return
+	}
+
+	service := serviceConfig(asset.ServiceType, asset.ServiceScope, asset.ServiceUser, asset.Container)
+	if service.Type == taskservice.Container && asset.ServiceAction != configuration.ServiceActionNone {
+		copyErrs := fnCopy()
+		errs.Concat(copyErrs)
+		if copyErrs.LevelIsError() || u.ctx.Err() != nil {
+			return
+		}
+		archive := ""
+		if asset.Container.Load {
+			archive = asset.SystemPath
+		}
+		errs.Add(u.deployContainer(&logger, asset.Service, *asset.Container, archive, asset.StartTimeout))
+		return
+	}
+
+	switch asset.ServiceAction {
+	case configuration.ServiceActionRestart, configuration.ServiceActionReload:
+		copyErrs := fnCopy()
+		errs.Concat(copyErrs)
+		if copyErrs.LevelIsError() || u.ctx.Err() != nil {
+			return
+		}
+		logger.Info().Msgf("%s %s", asset.ServiceAction, asset.Service)
+		if err = u.serviceAction(&logger, asset.Service, service, asset.ServiceAction, asset.StartTimeout); err != nil {
+			logger.Warn().Err(err).Msgf("error on %s %s", asset.ServiceAction, asset.Service)
+			errs.Add(ErrError{err})
+		}
+		return
+	case configuration.ServiceActionNone:
+		errs.Concat(fnCopy())
+		return
+	}
+
 	// TODO this needs a mutex?
 	logger.Info().Msgf("stop %s", asset.Service)
-	if err = u.io.ServiceStop(asset.Service, taskservice.ServiceTypeFrom(asset.ServiceType)); err != nil {
+	if err = u.io.ServiceStop(asset.Service, service); err != nil {
 		logger.Warn().Err(err).Msgf("error stoping %s", asset.Service)
 		errs.Add(ErrWarning{fmt.Errorf("updateTask Stop() %w", err)})
 	}
 
 	defer func() {
 		logger.Info().Msgf("start %s", asset.Service)
-		if err := u.io.ServiceStart(asset.Service, taskservice.ServiceTypeFrom(asset.ServiceType)); err != nil {
+		if err := u.io.ServiceStart(asset.Service, service); err != nil {
 			logger.Warn().Err(err).Msgf("error starting %s", asset.Service)
 			errs.Add(ErrError{err})
+			u.attachJournal(&logger, asset.Service, service)
+			return
+		}
+		if err := u.waitReady(&logger, asset.Service, service, asset.StartTimeout); err != nil {
+			logger.Warn().Err(err).Msgf("error starting %s", asset.Service)
+			errs.Add(err)
 		}
 	}()
 
-	err = fnCopy()
-	errs.Add(err)
+	errs.Concat(fnCopy())
 	return
 }
 
-func (u *appUpdater) updateAsset(logger zerolog.Logger, asset configuration.Asset) (fnCopy func() (err error), err error) {
+// serviceConfig is the service manager of the service of an app or an asset.
+// The container is the one of the services of type container, nil for the others
+func serviceConfig(serviceType string, scope string, user string, container *configuration.Container) taskservice.Config {
+	config := taskservice.Config{
+		Type:  taskservice.ServiceTypeFrom(serviceType),
+		Scope: taskservice.Scope(scope),
+		User:  user,
+	}
+	if container != nil {
+		config.Runtime = container.Runtime
+	}
+	return config
+}
+
+// serviceAction restarts or reloads the service. After a restart waits for the service to be ready
+func (u *appUpdater) serviceAction(logger *zerolog.Logger, name string, service taskservice.Config, action string, startTimeout *configuration.Duration) error {
+	if action == configuration.ServiceActionReload {
+		return u.io.ServiceReload(name, service)
+	}
+	if err := u.io.ServiceRestart(name, service); err != nil {
+		u.attachJournal(logger, name, service)
+		return err
+	}
+	return u.waitReady(logger, name, service, startTimeout)
+}
+
+// deployContainer replaces the container, see taskservice.ContainerService.Deploy
+func (u *appUpdater) deployContainer(logger *zerolog.Logger, name string, container configuration.Container, archive string, startTimeout *configuration.Duration) error {
+	timeout := defaultStartTimeout
+	if startTimeout != nil {
+		timeout = startTimeout.GoDuration()
+	}
+	logger.Info().Msgf("deploying container %s from %s", name, container.Image)
+	if err := u.io.ContainerDeploy(u.ctx, name, container, archive, timeout); err != nil {
+		logger.Error().Err(err).Msgf("deploying container %s", name)
+		return ErrError{err}
+	}
+	return nil
+}
+
+// waitReady waits for a started service to be active for the settle window.
+// A nil timeout is defaultStartTimeout and zero disables the wait. It does not wait on a cancelled update
+func (u *appUpdater) waitReady(logger *zerolog.Logger, name string, service taskservice.Config, timeout *configuration.Duration) error {
+	wait := defaultStartTimeout
+	if timeout != nil {
+		wait = timeout.GoDuration()
+	}
+	if wait <= 0 || u.ctx.Err() != nil {
+		return nil
+	}
+	logger.Info().Msgf("waiting for %s to be ready", name)
+	if err := u.io.ServiceWaitReady(u.ctx, name, service, wait); err != nil {
+		u.attachJournal(logger, name, service)
+		return ErrError{err}
+	}
+	return nil
+}
+
+// finish sets the status and the results of the update and registers it as finished
+func (u *appUpdater) finish(result *Result) {
+	result.Commands = u.CommandResults()
+	result.ServiceLogs = u.ServiceLogs()
+	result.Services = u.serviceResults
+	switch {
+	case u.ctx.Err() != nil:
+		result.Status = UpdateCancelled
+	case result.LevelIsError():
+		result.Status = UpdateFailed
+	default:
+		result.Status = UpdateSuccess
+	}
+	updates.finish(*result)
+}
+
+// addServiceResult records an operation on an app level service
+func (u *appUpdater) addServiceResult(name string, operation string, err error) {
+	result := ServiceResult{Service: name, Operation: operation}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	u.serviceResults = append(u.serviceResults, result)
+}
+
+// number of lines of the journal attached to the update when a service fails to start
+const serviceJournalLines = 50
+
+// attachJournal writes to the update log the end of the journal of a service that failed to start, since
+// the start of the update, and keeps it for the result. It does nothing if the service type has no journal
+func (u *appUpdater) attachJournal(logger *zerolog.Logger, name string, service taskservice.Config) {
+	lines, err := u.io.ServiceJournal(name, service, u.started, serviceJournalLines)
+	if errors.Is(err, taskservice.ErrNotSupported) {
+		return
+	}
+	if err != nil {
+		logger.Warn().Err(err).Msgf("reading the journal of %s", name)
+		return
+	}
+	if len(lines) == 0 {
+		return
+	}
+	logger.Error().Msgf("journal of %s:\n%s", name, strings.Join(lines, "\n"))
+
+	u.serviceLogsMut.Lock()
+	u.serviceLogs = append(u.serviceLogs, ServiceLog{Service: name, Lines: lines})
+	u.serviceLogsMut.Unlock()
+}
+
+// ServiceLogs returns the journals of the services that failed to start
+func (u *appUpdater) ServiceLogs() []ServiceLog {
+	u.serviceLogsMut.Lock()
+	defer u.serviceLogsMut.Unlock()
+	return slices.Clone(u.serviceLogs)
+}
+
+// installUnit reloads systemd and enables the unit file of the asset
+func (u *appUpdater) installUnit(logger zerolog.Logger, asset configuration.Asset) error {
+	service := serviceConfig(asset.ServiceType, asset.ServiceScope, asset.ServiceUser, asset.Container)
+	unit := filepath.Base(asset.SystemPath)
+	logger.Info().Msgf("reloading unit files and enabling %s", unit)
+	if err := u.io.DaemonReload(service); err != nil {
+		return err
+	}
+	return u.io.ServiceEnable(unit, service)
+}
+
+// updateAsset returns the function that copies the asset. The warnings of the asset commands are added to
+// the errors of the copy and it continues, an error stops it
+func (u *appUpdater) updateAsset(logger zerolog.Logger, asset configuration.Asset) (fnCopy func() (errs JoinErrors), err error) {
 	data := u.seek(asset)
 	if data == nil {
 		msg := "updateAsset() no match " + asset.Name
 		logger.Warn().Msg(msg)
 		return nil, ErrWarning{errors.New(msg)}
 	}
+	data = newCancelableReader(u.ctx, data)
 
-	fnCopy = func() (err error) {
+	fnCopy = func() (errs JoinErrors) {
 		defer data.Close()
 
+		if u.ctx.Err() != nil {
+			logger.Warn().Msgf("update cancelled, skipping %s", asset.Name)
+			return
+		}
+
 		logger.Info().Msgf("Processing asset %s", asset.Name)
 
 		if asset.CommandPre != nil {
@@ -239,17 +567,19 @@ func (u *appUpdater) updateAsset(logger zerolog.Logger, asset configuration.Asse
 				return c.Str("asset", asset.Name).Str("kind", "pre")
 			})
 			logger.Info().Msg("Running pre action commnad")
-			err = u.io.RunCommand(&logger, *asset.CommandPre)
+			err := u.runCommand(&logger, *asset.CommandPre, asset, "pre")
 			logger.Info().Msg("Finished running pre action commnad")
-			if err != nil {
-				return err
+			errs.Add(err)
+			if isError(err) {
+				return
 			}
 		}
 
 		SystemPathOld := asset.SystemPath + ".old"
 
-		if err = u.io.RenameSafe(asset.SystemPath, SystemPathOld); err != nil {
-			return fmt.Errorf("RenameSafe failed: %w", err)
+		if err := u.io.RenameSafe(asset.SystemPath, SystemPathOld); err != nil {
+			errs.Add(fmt.Errorf("RenameSafe failed: %w", err))
+			return
 		}
 
 		rollback := func() {
@@ -261,18 +591,45 @@ func (u *appUpdater) updateAsset(logger zerolog.Logger, asset configuration.Asse
 		}
 
 		logger.Info().Msgf("Copying from %s to %s", asset.Name, asset.SystemPath)
-		if err = u.io.CopyFromReader(data, asset.SystemPath); err != nil {
+		if err := u.io.CopyFromReader(data, asset.SystemPath); err != nil {
 			logger.Error().Err(err).Msgf("Copying from %s to %s. Rollback, move %s to %s", asset.Name, asset.SystemPath, SystemPathOld, asset.SystemPath)
 			rollback()
-			return ErrError{err}
+			errs.Add(ErrError{err})
+			return
 		}
 
 		if asset.Unzip {
 			logger.Info().Msg("unzip: " + asset.SystemPath)
-			if err = u.io.Unzip(asset.SystemPath); err != nil {
+			if err := u.io.Unzip(asset.SystemPath); err != nil {
 				logger.Error().Err(err).Msg("unzip: " + asset.SystemPath)
 				rollback()
-				return ErrError{err}
+				errs.Add(ErrError{err})
+				return
+			}
+		}
+
+		// the asset in progress is rolled back when the update is cancelled
+		cancelled := func() bool {
+			if u.ctx.Err() == nil {
+				return false
+			}
+			logger.Warn().Msgf("update cancelled. Rollback, move %s to %s", SystemPathOld, asset.SystemPath)
+			rollback()
+			return true
+		}
+		if cancelled() {
+			return
+		}
+
+		if asset.UnitFile {
+			if err := u.installUnit(logger, asset); err != nil {
+				logger.Error().Err(err).Msgf("installing unit file %s. Rollback, move %s to %s", asset.SystemPath, SystemPathOld, asset.SystemPath)
+				rollback()
+				if errReload := u.io.DaemonReload(serviceConfig(asset.ServiceType, asset.ServiceScope, asset.ServiceUser, asset.Container)); errReload != nil {
+					logger.Error().Err(errReload).Msg("reloading unit files after the rollback")
+				}
+				errs.Add(ErrError{err})
+				return
 			}
 		}
 
@@ -282,10 +639,14 @@ func (u *appUpdater) updateAsset(logger zerolog.Logger, asset configuration.Asse
 				return c.Str("asset", asset.Name).Str("kind", "post")
 			})
 			logger.Info().Msg("Running post action command")
-			err = u.io.RunCommand(&logger, *asset.Command)
+			err := u.runCommand(&logger, *asset.Command, asset, "post")
 			logger.Info().Msg("Finished running post action command")
-			if err != nil {
-				return err
+			if cancelled() {
+				return
+			}
+			errs.Add(err)
+			if isError(err) {
+				return
 			}
 		}
 
@@ -293,17 +654,59 @@ func (u *appUpdater) updateAsset(logger zerolog.Logger, asset configuration.Asse
 			u.io.Remove(SystemPathOld) //nolint: errcheck
 		}
 		logger.Info().Msgf("Asset %s updated successfully", asset.Name)
-		return nil
+		return
 	}
 	return
 }
 
+// runCommand expands the command templates, runs it and records the result.
+// asset is the zero value for app level commands
+func (u *appUpdater) runCommand(logger *zerolog.Logger, command configuration.Command, asset configuration.Asset, kind string) error {
+	return u.runCommandVars(logger, command, u.commandVars(asset, u.color), kind)
+}
+
+// commandVars returns the template variables of the commands of the update
+func (u *appUpdater) commandVars(asset configuration.Asset, color string) CommandVars {
+	return CommandVars{
+		App:       u.app,
+		Asset:     asset,
+		Release:   u.release,
+		RequestID: u.requestID,
+		DryRun:    u.dryRun,
+		Color:     color,
+	}
+}
+
+func (u *appUpdater) runCommandVars(logger *zerolog.Logger, command configuration.Command, vars CommandVars, kind string) error {
+	asset := vars.Asset
+	command, err := ExpandCommand(command, vars)
+	if err != nil {
+		logger.Error().Err(err).Msg("expanding command templates")
+		return ErrError{fmt.Errorf("expanding command templates %w", err)}
+	}
+	result, err := u.io.RunCommand(u.ctx, logger, command)
+	result.Asset = asset.Name
+	result.Kind = kind
+
+	u.commandsMut.Lock()
+	u.commands = append(u.commands, result)
+	u.commandsMut.Unlock()
+	return err
+}
+
+// CommandResults returns the results of all the commands run by the updater
+func (u *appUpdater) CommandResults() []CommandResult {
+	u.commandsMut.Lock()
+	defer u.commandsMut.Unlock()
+	return slices.Clone(u.commands)
+}
+
 func (u *appUpdater) RunPreAction() error {
 	if u.app.CommandPre == nil {
 		return nil
 	}
 	u.log.Info().Msg("Running pre action command")
-	err := u.io.RunCommand(u.log, *u.app.CommandPre)
+	err := u.runCommand(u.log, *u.app.CommandPre, configuration.Asset{}, "pre")
 	u.log.Info().Msg("Finish running pre action command")
 	return err
 }
@@ -313,7 +716,7 @@ func (u *appUpdater) RunPostAction() error {
 		return nil
 	}
 	u.log.Info().Msg("Running post action command")
-	err := u.io.RunCommand(u.log, *u.app.Command)
+	err := u.runCommand(u.log, *u.app.Command, configuration.Asset{}, "post")
 	u.log.Info().Msg("Finish running post action command")
 	return err
 }
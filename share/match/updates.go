@@ -0,0 +1,226 @@
+package match
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// ErrUpdateCancelled is added to the result of a cancelled update
+var ErrUpdateCancelled = errors.New("update cancelled")
+
+// ErrUpdateNotFound is returned when cancelling an update that is not running
+var ErrUpdateNotFound = errors.New("update not found")
+
+type UpdateStatus string
+
+const (
+	UpdateRunning   UpdateStatus = "running"
+	UpdateSuccess   UpdateStatus = "success"
+	UpdateFailed    UpdateStatus = "failed"
+	UpdateCancelled UpdateStatus = "cancelled"
+)
+
+// UpdateInfo describes a running or finished update
+type UpdateInfo struct {
+	ID         string       `json:"id"`
+	App        string       `json:"app"`
+	DryRun     bool         `json:"dry_run"`
+	Status     UpdateStatus `json:"status"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at,omitzero"`
+	// commands run by a finished update, only set by FindUpdate
+	Commands []CommandResult `json:"commands,omitempty"`
+	// operations on the app level services, only set by FindUpdate
+	Services []ServiceResult `json:"services,omitempty"`
+	// journal of the services that failed to start, only set by FindUpdate
+	ServiceLogs []ServiceLog `json:"service_logs,omitempty"`
+}
+
+// number of finished updates that are kept
+const maxFinishedUpdates = 100
+
+type runningUpdate struct {
+	info   UpdateInfo
+	cancel context.CancelFunc
+}
+
+type updateRegistry struct {
+	mut      sync.Mutex
+	running  map[string]*runningUpdate
+	finished []UpdateInfo
+}
+
+var updates = &updateRegistry{running: make(map[string]*runningUpdate)}
+
+// start registers a running update, the returned context is cancelled by CancelUpdate.
+// If id is empty or already in use a new one is generated
+func (r *updateRegistry) start(ctx context.Context, id string, app string, dryRun bool) (context.Context, string) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if _, ok := r.running[id]; ok || id == "" {
+		id = xid.New().String()
+	}
+	r.running[id] = &runningUpdate{
+		info: UpdateInfo{
+			ID:        id,
+			App:       app,
+			DryRun:    dryRun,
+			Status:    UpdateRunning,
+			StartedAt: time.Now(),
+		},
+		cancel: cancel,
+	}
+	return ctx, id
+}
+
+func (r *updateRegistry) finish(result Result) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	update, ok := r.running[result.ID]
+	if !ok {
+		return
+	}
+	delete(r.running, result.ID)
+	update.cancel()
+	update.info.Status = result.Status
+	update.info.FinishedAt = time.Now()
+	update.info.Commands = result.Commands
+	update.info.Services = result.Services
+	update.info.ServiceLogs = result.ServiceLogs
+	r.finished = append(r.finished, update.info)
+	if len(r.finished) > maxFinishedUpdates {
+		r.finished = slices.Delete(r.finished, 0, len(r.finished)-maxFinishedUpdates)
+	}
+}
+
+func (r *updateRegistry) cancel(id string) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	update, ok := r.running[id]
+	if !ok {
+		return ErrUpdateNotFound
+	}
+	update.cancel()
+	return nil
+}
+
+func (r *updateRegistry) find(id string) (UpdateInfo, bool) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if update, ok := r.running[id]; ok {
+		return update.info, true
+	}
+	for _, info := range r.finished {
+		if info.ID == id {
+			return info, true
+		}
+	}
+	return UpdateInfo{}, false
+}
+
+// last returns the newest update of the application that is not a dry run, without the commands and services
+func (r *updateRegistry) last(app string) (UpdateInfo, bool) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	var result UpdateInfo
+	found := false
+	for _, update := range r.running {
+		if update.info.App == app && !update.info.DryRun && (!found || update.info.StartedAt.After(result.StartedAt)) {
+			result, found = update.info, true
+		}
+	}
+	if found {
+		return result, true
+	}
+	for i := len(r.finished) - 1; i >= 0; i-- {
+		if info := r.finished[i]; info.App == app && !info.DryRun {
+			info.Commands = nil
+			info.Services = nil
+			info.ServiceLogs = nil
+			return info, true
+		}
+	}
+	return UpdateInfo{}, false
+}
+
+func (r *updateRegistry) list() []UpdateInfo {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	result := make([]UpdateInfo, 0, len(r.running)+len(r.finished))
+	for _, update := range r.running {
+		result = append(result, update.info)
+	}
+	slices.SortFunc(result, func(a, b UpdateInfo) int {
+		return b.StartedAt.Compare(a.StartedAt)
+	})
+	for i := len(r.finished) - 1; i >= 0; i-- {
+		info := r.finished[i]
+		info.Commands = nil
+		info.Services = nil
+		info.ServiceLogs = nil
+		result = append(result, info)
+	}
+	return result
+}
+
+// CancelUpdate cancels the running update with the given id. The update stops the running command or copy,
+// rolls back the asset in progress and restarts the services that were stopped
+func CancelUpdate(id string) error {
+	return updates.cancel(id)
+}
+
+// Updates returns the running updates, newest first, followed by the last finished ones
+func Updates() []UpdateInfo {
+	return updates.list()
+}
+
+// FindUpdate returns the update with the given id including the results of his commands and services
+func FindUpdate(id string) (UpdateInfo, error) {
+	info, ok := updates.find(id)
+	if !ok {
+		return info, ErrUpdateNotFound
+	}
+	return info, nil
+}
+
+// cancelableReader closes the reader when ctx is cancelled, unblocking any pending read
+type cancelableReader struct {
+	ctx  context.Context
+	rc   io.ReadCloser
+	stop func() bool
+}
+
+func newCancelableReader(ctx context.Context, rc io.ReadCloser) *cancelableReader {
+	return &cancelableReader{
+		ctx:  ctx,
+		rc:   rc,
+		stop: context.AfterFunc(ctx, func() { rc.Close() }),
+	}
+}
+
+func (r *cancelableReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.rc.Read(p)
+	if err != nil && r.ctx.Err() != nil {
+		return n, r.ctx.Err()
+	}
+	return n, err
+}
+
+func (r *cancelableReader) Close() error {
+	if !r.stop() {
+		// already closed by the cancellation
+		return nil
+	}
+	return r.rc.Close()
+}
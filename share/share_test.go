@@ -6,6 +6,7 @@ import (
 	"io"
 	"math/rand/v2"
 	"os"
+	"os/user"
 	"path/filepath"
 	"runtime"
 	"strconv"
@@ -30,7 +31,11 @@ type TestData map[string]io.Reader
 
 func (t TestData) Clean() {}
 func (t TestData) Get(name string) io.ReadCloser {
-	return io.NopCloser(t[name])
+	r, ok := t[name]
+	if !ok {
+		return nil
+	}
+	return io.NopCloser(r)
 }
 
 // TODO add tests
@@ -76,6 +81,7 @@ func TestDependencyCyclicError(t *testing.T) {
 	user_jwt_expiry: "2m"
 	apps: [
 		{
+			name: "app1"
 			assets_dependency: {
 				"asset1": ["asset2"]
 				"asset2": ["asset3"]
@@ -101,6 +107,7 @@ func TestDependencyCyclicError(t *testing.T) {
 			]
 		},
 		{
+			name:       "app2"
 			auth_token: "-"
 
 			assets: [
@@ -120,6 +127,11 @@ func TestDependencyCyclicError(t *testing.T) {
 	`
 	err := share.ReloadString(errConfig)
 	require.Error(t, err)
+	errs, ok := err.(configuration.ValidationErrors)
+	require.True(t, ok)
+	require.Len(t, errs, 1)
+	assert.Equal(t, configuration.KindDependencyCycle, errs[0].Kind)
+	assert.True(t, strings.HasPrefix(errs[0].Path, "apps.0.assets_dependency."), errs[0].Path)
 }
 
 func TestDependencyNoCyclicError(t *testing.T) {
@@ -129,6 +141,7 @@ func TestDependencyNoCyclicError(t *testing.T) {
 	user_jwt_expiry: "2m"
 	apps: [
 		{
+			name: "app1"
 			assets_dependency: {
 				"asset1": ["asset2"]
 				"asset2": ["asset3", "asset5"]
@@ -171,6 +184,7 @@ func TestDependencyNoCyclicError(t *testing.T) {
 			]
 		},
 		{
+			name:       "app2"
 			auth_token: "-"
 
 			assets: [
@@ -283,6 +297,7 @@ func TestReload(t *testing.T) {
 		UserJwtExpiry: configuration.Duration(2 * time.Hour),
 		Apps: []configuration.Application{
 			{
+				Name:      "app1",
 				AuthToken: "auth",
 				Assets: []configuration.Asset{
 					{
@@ -329,7 +344,7 @@ func TestConfigPathValidationLinux(t *testing.T) {
 	}
 
 	err := share.ConfigPathValidation(conf)
-	assert.Equal(t, []string{}, err)
+	assert.Equal(t, configuration.ValidationErrors{}, err)
 }
 
 func TestConfigPathValidationWindows(t *testing.T) {
@@ -353,7 +368,7 @@ func TestConfigPathValidationWindows(t *testing.T) {
 	}
 
 	err := share.ConfigPathValidation(conf)
-	assert.Equal(t, []string{}, err)
+	assert.Equal(t, configuration.ValidationErrors{}, err)
 }
 
 func TestPostActionCommand(t *testing.T) {
@@ -481,3 +496,250 @@ func TestUnzip(t *testing.T) {
 		})
 	})
 }
+
+func TestCommandUnknownUser(t *testing.T) {
+	config := `
+	port:            11111
+	user_secret_key: ""
+	user_jwt_expiry: "2m"
+	apps: [
+		{
+			name: "app"
+			assets: [
+				{
+					name:        "asset"
+					system_path: "path"
+					cmd: {
+						command: "echo"
+						user:    "__updater_unknown_user__"
+					}
+				},
+			]
+		},
+	]
+	`
+	err := share.ReloadString(config)
+	require.Error(t, err)
+	errs, ok := err.(configuration.ValidationErrors)
+	require.True(t, ok)
+	require.Len(t, errs, 1)
+	assert.Equal(t, configuration.KindUnknownUser, errs[0].Kind)
+	assert.Equal(t, "apps.0.assets.0.cmd.user", errs[0].Path)
+}
+
+func TestCommandOrScript(t *testing.T) {
+	config := `
+	port:            11111
+	user_secret_key: ""
+	user_jwt_expiry: "2m"
+	apps: [
+		{
+			name:   "app"
+			assets: [{name: "asset", system_path: "path"}]
+			cmd_pre: {
+				command: "echo"
+				script:  "echo"
+			}
+			cmd: {
+				args: ["only args"]
+			}
+		},
+	]
+	`
+	err := share.ReloadString(config)
+	require.Error(t, err)
+	errs, ok := err.(configuration.ValidationErrors)
+	require.True(t, ok)
+	require.Len(t, errs, 2)
+	assert.Equal(t, configuration.KindInvalidCommand, errs[0].Kind)
+	assert.Equal(t, "apps.0.cmd_pre", errs[0].Path)
+	assert.Equal(t, "apps.0.cmd", errs[1].Path)
+}
+
+func TestCancelUpdate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	systemPath := filepath.Join(t.TempDir(), "asset")
+	require.NoError(t, os.WriteFile(systemPath, []byte("old"), 0644))
+
+	app := configuration.Application{
+		Name: "cancel_test_app",
+		Assets: []configuration.Asset{
+			{
+				Name:       "asset",
+				SystemPath: systemPath,
+				Command:    &configuration.Command{Command: "sleep", Args: []string{"10"}},
+			},
+		},
+	}
+	app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+
+	done := make(chan match.Result)
+	start := time.Now()
+	go func() {
+		done <- match.Update(
+			logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil),
+			app,
+			match.WithData(TestData{"asset": strings.NewReader("new")}),
+		)
+	}()
+
+	var id string
+	require.Eventually(t, func() bool {
+		for _, update := range match.Updates() {
+			if update.App == app.Name && update.Status == match.UpdateRunning {
+				id = update.ID
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+	// let the post command start
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, match.CancelUpdate(id))
+
+	result := <-done
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, id, result.ID)
+	assert.Equal(t, match.UpdateCancelled, result.Status)
+	assert.True(t, result.LevelIsError())
+
+	data, err := os.ReadFile(systemPath)
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+
+	assert.ErrorIs(t, match.CancelUpdate(id), match.ErrUpdateNotFound)
+	assert.Equal(t, match.UpdateCancelled, match.Updates()[0].Status)
+}
+
+func TestAppStatus(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.SkipNow()
+	}
+	dir := t.TempDir()
+	app := configuration.Application{
+		Name: "status_test_app",
+		Assets: []configuration.Asset{
+			{Name: "deployed", SystemPath: filepath.Join(dir, "deployed")},
+			{Name: "missing", SystemPath: filepath.Join(dir, "missing")},
+		},
+	}
+	app.AsstesOrder = []configuration.AssetOrder{{Asset: app.Assets[0]}}
+
+	status := match.GetAppStatus(app)
+	assert.Nil(t, status.LastUpdate)
+
+	result := match.Update(
+		logger.LoggerCtx_WithContex(context.Background(), &log.Logger, nil),
+		app,
+		match.WithData(TestData{"deployed": strings.NewReader("content")}),
+	)
+	require.True(t, result.IsEmpty())
+
+	status = match.GetAppStatus(app)
+	assert.Equal(t, app.Name, status.App)
+	assert.Empty(t, status.Services)
+	require.Len(t, status.Assets, 2)
+	assert.True(t, status.Assets[0].Exists)
+	assert.Equal(t, int64(len("content")), status.Assets[0].Size)
+	assert.False(t, status.Assets[0].ModTime.IsZero())
+	assert.False(t, status.Assets[1].Exists)
+	require.NotNil(t, status.LastUpdate)
+	assert.Equal(t, result.ID, status.LastUpdate.ID)
+	assert.Equal(t, match.UpdateSuccess, status.LastUpdate.Status)
+}
+
+func TestConfigContainerValidation(t *testing.T) {
+	container := &configuration.Container{Image: "app:latest"}
+	config := configuration.Configuration{Apps: []configuration.Application{
+		{Service: "web", ServiceType: "container", Container: container},
+		{Service: "web", ServiceType: "container"},
+		{Assets: []configuration.Asset{{Name: "a", ServiceType: "container", Container: container}}},
+		{Service: "web", Container: container},
+	}}
+	errs := share.ConfigContainerValidation(config)
+	paths := []string{}
+	for _, err := range errs {
+		assert.Equal(t, configuration.KindInvalidContainer, err.Kind)
+		paths = append(paths, err.Path)
+	}
+	assert.Equal(t, []string{"apps.1.container", "apps.2.assets.0.service", "apps.3.container"}, paths)
+}
+
+func TestConfigServiceScopeValidation(t *testing.T) {
+	current, err := user.Current()
+	require.NoError(t, err)
+	config := configuration.Configuration{Apps: []configuration.Application{
+		{Service: "web", ServiceType: "systemd", ServiceScope: "user", ServiceUser: current.Username},
+		{Service: "web", ServiceType: "openrc", ServiceScope: "user"},
+		{Assets: []configuration.Asset{{Name: "a", ServiceType: "systemd", ServiceUser: current.Username}}},
+		{Service: "web", ServiceType: "systemd", ServiceScope: "user", ServiceUser: "updater-unknown-user"},
+	}}
+	errs := share.ConfigServiceScopeValidation(config)
+	kinds := map[string]configuration.ErrorKind{}
+	for _, err := range errs {
+		kinds[err.Path] = err.Kind
+	}
+	assert.Equal(t, map[string]configuration.ErrorKind{
+		"apps.1.service_scope":         configuration.KindSchema,
+		"apps.2.assets.0.service_user": configuration.KindSchema,
+		"apps.3.service_user":          configuration.KindUnknownUser,
+	}, kinds)
+}
+
+func TestConfigServicesValidation(t *testing.T) {
+	config := configuration.Configuration{Apps: []configuration.Application{
+		{Services: []configuration.Service{{Name: "web"}, {Name: "worker"}}},
+		{Service: "web", Services: []configuration.Service{{Name: "worker"}}},
+		{Services: []configuration.Service{{Name: "web"}, {Name: "web"}}},
+	}}
+	errs := share.ConfigServicesValidation(config)
+	paths := []string{}
+	for _, err := range errs {
+		paths = append(paths, err.Path)
+	}
+	assert.Equal(t, []string{"apps.1.services", "apps.2.services.1.name"}, paths)
+
+	errs = share.ConfigContainerValidation(configuration.Configuration{Apps: []configuration.Application{
+		{Services: []configuration.Service{{Type: "container", Container: &configuration.Container{Image: "web", Load: true}}}},
+	}})
+	paths = []string{}
+	for _, err := range errs {
+		paths = append(paths, err.Path)
+	}
+	assert.Equal(t, []string{"apps.0.services.0.name", "apps.0.services.0.container.load"}, paths)
+}
+
+func TestConfigBlueGreenValidation(t *testing.T) {
+	blueGreen := &configuration.BlueGreen{Service: "app@.service", ReleaseDir: "/srv/app"}
+	config := configuration.Configuration{Apps: []configuration.Application{
+		{BlueGreen: blueGreen, Assets: []configuration.Asset{{Name: "bin", SystemPath: "bin/app"}}},
+		{BlueGreen: &configuration.BlueGreen{Service: "app@.service", ReleaseDir: "srv/app"}},
+		{BlueGreen: blueGreen, Assets: []configuration.Asset{
+			{Name: "bin", SystemPath: "/srv/app/bin"},
+			{Name: "conf", SystemPath: "../conf"},
+			{Name: "lib", SystemPath: "lib", Service: "app.service"},
+		}},
+	}}
+	errs := share.ConfigBlueGreenValidation(config)
+	paths := []string{}
+	for _, err := range errs {
+		paths = append(paths, err.Path)
+	}
+	assert.Equal(t, []string{
+		"apps.1.blue_green.release_dir", "apps.2.assets.0.system_path", "apps.2.assets.1.system_path", "apps.2.assets.2.service",
+	}, paths)
+}
+
+func TestConfigAppsCronFileNameValidation(t *testing.T) {
+	config := configuration.Configuration{Apps: []configuration.Application{
+		{Name: "my.app"},
+		{Name: "other"},
+		{Name: "my_app"},
+	}}
+	errs := share.ConfigAppsCronFileNameValidation(config)
+	require.Len(t, errs, 1)
+	assert.Equal(t, configuration.KindDuplicateAppName, errs[0].Kind)
+	assert.Equal(t, "apps.2.name", errs[0].Path)
+}
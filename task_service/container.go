@@ -0,0 +1,182 @@
+package taskservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PreviousImageTag is the tag given to the image of the replaced container, so it can be rolled back
+const PreviousImageTag = "updater-previous"
+
+// ContainerSpec is the container run by ContainerService.Deploy
+type ContainerSpec struct {
+	Name    string
+	Image   string
+	Ports   []string
+	Volumes []string
+	Env     map[string]string
+	Args    []string
+}
+
+// ContainerService manages containers with the docker or podman cli, the service name is the container name
+type ContainerService struct {
+	// docker or podman, if empty docker is used if found on PATH, else podman
+	Runtime string
+}
+
+func (c ContainerService) runtime() string {
+	if c.Runtime != "" {
+		return c.Runtime
+	}
+	if _, err := exec.LookPath("docker"); err == nil {
+		return "docker"
+	}
+	if _, err := exec.LookPath("podman"); err == nil {
+		return "podman"
+	}
+	return "docker"
+}
+
+func (c ContainerService) cli(ctx context.Context, args ...string) (string, error) {
+	return runContext(ctx, c.runtime(), args...)
+}
+
+func (c ContainerService) Start(name string) error {
+	_, err := c.cli(context.Background(), "start", name)
+	return err
+}
+
+func (c ContainerService) Stop(name string) error {
+	_, err := c.cli(context.Background(), "stop", name)
+	return err
+}
+
+func (c ContainerService) Restart(name string) error {
+	_, err := c.cli(context.Background(), "restart", name)
+	return err
+}
+
+// Reload sends a HUP to the container
+func (c ContainerService) Reload(name string) error {
+	_, err := c.cli(context.Background(), "kill", "--signal", "HUP", name)
+	return err
+}
+
+func (c ContainerService) Status(name string) (Status, error) {
+	out, err := c.cli(context.Background(), "container", "inspect", "--format", "{{.State.Status}} {{.State.Pid}} {{.State.ExitCode}} {{.State.StartedAt}}", name)
+	if err != nil {
+		return Status{}, err
+	}
+	fields := strings.Fields(out)
+	if len(fields) < 3 {
+		return Status{}, fmt.Errorf("unexpected inspect output %q", out)
+	}
+	status := Status{SubState: fields[0], Result: "success"}
+	if fields[2] != "0" {
+		status.Result = "exit-code"
+	}
+	switch fields[0] {
+	case "running":
+		status.State = StateActive
+		status.MainPID, _ = strconv.Atoi(fields[1])
+		if len(fields) > 3 {
+			status.StartedAt, _ = time.Parse(time.RFC3339Nano, fields[3])
+		}
+	case "created":
+		status.State = StateActivating
+	case "restarting":
+		status.State = StateActivating
+		status.SubState = "auto-restart"
+	case "dead":
+		status.State = StateFailed
+	default:
+		status.State = StateInactive
+	}
+	return status, nil
+}
+
+// Deploy loads the image from archive, a docker save tarball, or pulls it if archive is empty.
+// Then replaces the container, tagging the image of the old one with PreviousImageTag.
+// If the new container fails to start, or is not ready after startTimeout (zero does not wait),
+// the container is started again from the previous image
+func (c ContainerService) Deploy(ctx context.Context, spec ContainerSpec, archive string, startTimeout time.Duration, settle time.Duration) error {
+	if archive != "" {
+		if _, err := c.cli(ctx, "load", "--input", archive); err != nil {
+			return err
+		}
+	} else if _, err := c.cli(ctx, "pull", spec.Image); err != nil {
+		return err
+	}
+
+	previous := ""
+	if id, err := c.cli(ctx, "container", "inspect", "--format", "{{.Image}}", spec.Name); err == nil {
+		previous = imageRepository(spec.Image) + ":" + PreviousImageTag
+		if _, err = c.cli(ctx, "tag", strings.TrimSpace(id), previous); err != nil {
+			return err
+		}
+		if err = c.remove(ctx, spec.Name); err != nil {
+			return err
+		}
+	}
+
+	err := c.run(ctx, spec, spec.Image, startTimeout, settle)
+	if err == nil || previous == "" {
+		return err
+	}
+	// the rollback runs even if the update was cancelled
+	ctx = context.WithoutCancel(ctx)
+	if errRemove := c.remove(ctx, spec.Name); errRemove != nil {
+		return errors.Join(err, errRemove)
+	}
+	if errPrevious := c.run(ctx, spec, previous, startTimeout, settle); errPrevious != nil {
+		return errors.Join(err, fmt.Errorf("rollback to %s %w", previous, errPrevious))
+	}
+	return fmt.Errorf("%w, rolled back to %s", err, previous)
+}
+
+// remove stops the container, with a SIGTERM and a SIGKILL after the stop timeout of the runtime, and removes it
+func (c ContainerService) remove(ctx context.Context, name string) error {
+	if _, err := c.cli(ctx, "stop", name); err != nil {
+		return err
+	}
+	_, err := c.cli(ctx, "rm", name)
+	return err
+}
+
+func (c ContainerService) run(ctx context.Context, spec ContainerSpec, image string, startTimeout time.Duration, settle time.Duration) error {
+	args := []string{"run", "--detach", "--name", spec.Name}
+	for _, port := range spec.Ports {
+		args = append(args, "--publish", port)
+	}
+	for _, volume := range spec.Volumes {
+		args = append(args, "--volume", volume)
+	}
+	for _, k := range slices.Sorted(maps.Keys(spec.Env)) {
+		args = append(args, "--env", k+"="+spec.Env[k])
+	}
+	args = append(args, image)
+	args = append(args, spec.Args...)
+	if _, err := c.cli(ctx, args...); err != nil {
+		return err
+	}
+	if startTimeout <= 0 {
+		return nil
+	}
+	return WaitReady(ctx, c, spec.Name, startTimeout, settle)
+}
+
+// imageRepository returns the image reference without tag nor digest
+func imageRepository(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
@@ -0,0 +1,57 @@
+//go:build linux
+
+package taskservice
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpenRCService manages the services of OpenRC with rc-service
+type OpenRCService struct{}
+
+func (OpenRCService) Start(name string) error {
+	_, err := run("rc-service", name, "start")
+	return err
+}
+
+func (OpenRCService) Stop(name string) error {
+	_, err := run("rc-service", name, "stop")
+	return err
+}
+
+func (OpenRCService) Restart(name string) error {
+	_, err := run("rc-service", name, "restart")
+	return err
+}
+
+func (OpenRCService) Reload(name string) error {
+	_, err := run("rc-service", name, "reload")
+	return err
+}
+
+// Status parses the output of rc-service status, the exit code is not 0 for the stopped services.
+// OpenRC does not report the pid nor the start time
+func (OpenRCService) Status(name string) (Status, error) {
+	out, err := run("rc-service", name, "status")
+	_, state, found := strings.Cut(out, "status:")
+	if !found {
+		if err == nil {
+			err = fmt.Errorf("rc-service %s status unexpected output %q", name, out)
+		}
+		return Status{}, err
+	}
+	state = strings.TrimSpace(state)
+	status := Status{SubState: state}
+	switch state {
+	case "started":
+		status.State = StateActive
+	case "starting":
+		status.State = StateActivating
+	case "crashed":
+		status.State = StateFailed
+	default:
+		status.State = StateInactive
+	}
+	return status, nil
+}
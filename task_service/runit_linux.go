@@ -0,0 +1,61 @@
+//go:build linux
+
+package taskservice
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunitService manages the services of runit with sv
+type RunitService struct{}
+
+func (RunitService) Start(name string) error {
+	_, err := run("sv", "start", name)
+	return err
+}
+
+func (RunitService) Stop(name string) error {
+	_, err := run("sv", "stop", name)
+	return err
+}
+
+func (RunitService) Restart(name string) error {
+	_, err := run("sv", "restart", name)
+	return err
+}
+
+// Reload sends a HUP to the service
+func (RunitService) Reload(name string) error {
+	_, err := run("sv", "hup", name)
+	return err
+}
+
+var runitStatusRegex = regexp.MustCompile(`^run: [^:]+: \(pid (\d+)\) (\d+)s`)
+
+// Status parses the output of sv status, like "run: app: (pid 123) 45s; run: log: (pid 122) 45s"
+func (RunitService) Status(name string) (Status, error) {
+	out, err := run("sv", "status", name)
+	if err != nil {
+		return Status{}, err
+	}
+	out = strings.TrimSpace(out)
+	if match := runitStatusRegex.FindStringSubmatch(out); match != nil {
+		status := Status{State: StateActive, SubState: "run"}
+		status.MainPID, _ = strconv.Atoi(match[1])
+		seconds, _ := strconv.Atoi(match[2])
+		status.StartedAt = time.Now().Add(-time.Duration(seconds) * time.Second).Truncate(time.Second)
+		return status, nil
+	}
+	state, _, _ := strings.Cut(out, ":")
+	status := Status{SubState: state}
+	switch state {
+	case "fail", "warning":
+		status.State = StateFailed
+	default:
+		status.State = StateInactive
+	}
+	return status, nil
+}
@@ -1,8 +1,113 @@
 package taskservice
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrNotSupported is returned by the services that do not support an operation
+var ErrNotSupported = errors.New("not supported")
+
 type Service interface {
 	Start(string) error
 	Stop(string) error
+	Restart(string) error
+	Reload(string) error
+	Status(string) (Status, error)
+}
+
+// UnitManager is implemented by the services that load their definition from unit files
+type UnitManager interface {
+	// DaemonReload reloads the unit files
+	DaemonReload() error
+	// Enable enables the unit to start on boot
+	Enable(string) error
+}
+
+// Journal is implemented by the services that keep the output of the services
+type Journal interface {
+	// Journal returns at most the last lines of the output of the service since the given time
+	Journal(name string, since time.Time, lines int) ([]string, error)
+}
+
+type State string
+
+const (
+	StateActive     State = "active"
+	StateActivating State = "activating"
+	StateInactive   State = "inactive"
+	StateFailed     State = "failed"
+)
+
+// Status is the state of a service, the main pid and start time are only set when it is active
+type Status struct {
+	State     State     `json:"state"`
+	MainPID   int       `json:"main_pid,omitempty"`
+	StartedAt time.Time `json:"started_at,omitzero"`
+	// systemd sub state and result of the last run, like "running" or "auto-restart" and "success" or "exit-code"
+	SubState string `json:"sub_state,omitempty"`
+	Result   string `json:"result,omitempty"`
+	// systemd unit type, like "simple" or "oneshot"
+	Type string `json:"type,omitempty"`
+}
+
+// ErrServiceNotReady is returned by WaitReady when the service does not become active or stops during the settle window
+var ErrServiceNotReady = errors.New("service not ready")
+
+// interval between the status queries of WaitReady
+const readyPollInterval = 200 * time.Millisecond
+
+// WaitReady polls the status of the service until it is active and then checks that it stays active during settle.
+// A oneshot systemd service that finishes successfully without becoming active is ready, any other service
+// that exits before becoming active is not.
+// timeout only limits the wait until the service is active
+func WaitReady(ctx context.Context, service Service, name string, timeout time.Duration, settle time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var activeSince time.Time
+	for {
+		status, err := service.Status(name)
+		if err != nil {
+			return err
+		}
+		switch status.State {
+		case StateActive:
+			if activeSince.IsZero() {
+				activeSince = time.Now()
+			}
+			if time.Since(activeSince) >= settle {
+				return nil
+			}
+		case StateActivating:
+			if status.SubState == "auto-restart" {
+				return fmt.Errorf("%s %w, it exited and is restarting (%s)", name, ErrServiceNotReady, status.Result)
+			}
+			if !activeSince.IsZero() {
+				return fmt.Errorf("%s %w, it stopped after starting (%s)", name, ErrServiceNotReady, status.SubState)
+			}
+		case StateInactive:
+			if activeSince.IsZero() && status.Result == "success" && status.Type == "oneshot" {
+				return nil
+			}
+			return fmt.Errorf("%s %w, it is inactive (%s)", name, ErrServiceNotReady, status.Result)
+		default:
+			return fmt.Errorf("%s %w, it is %s (%s)", name, ErrServiceNotReady, status.State, status.Result)
+		}
+		if activeSince.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("%s %w, it is not active after %s", name, ErrServiceNotReady, timeout)
+		}
+
+		timer := time.NewTimer(readyPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
 }
 
 type ServiceType int
@@ -11,15 +116,98 @@ const (
 	Systemctl ServiceType = iota
 	NNSM
 	TaskSched
+	OpenRC
+	Runit
+	Supervisord
+	Container
 )
 
+func (t ServiceType) String() string {
+	switch t {
+	case Systemctl:
+		return "systemd"
+	case NNSM:
+		return "nssm"
+	case TaskSched:
+		return "taskservice"
+	case OpenRC:
+		return "openrc"
+	case Runit:
+		return "runit"
+	case Supervisord:
+		return "supervisord"
+	case Container:
+		return "container"
+	default:
+		return fmt.Sprintf("ServiceType(%d)", int(t))
+	}
+}
+
+// ServiceTypeFrom returns the service type of the configuration value.
+// If empty the one detected on the host, see DefaultServiceType
 func ServiceTypeFrom(t string) ServiceType {
 	switch t {
 	case "nssm":
 		return NNSM
-	case "tasksched":
+	case "tasksched", "taskservice":
 		return TaskSched
+	case "systemd":
+		return Systemctl
+	case "openrc":
+		return OpenRC
+	case "runit":
+		return Runit
+	case "supervisord":
+		return Supervisord
+	case "container":
+		return Container
 	default:
-		return TaskSched
+		return DefaultServiceType()
+	}
+}
+
+// Scope is the service manager of systemd that runs a service, the one of the system or the one of a user
+type Scope string
+
+const (
+	ScopeSystem Scope = "system"
+	ScopeUser   Scope = "user"
+)
+
+// Config selects the service manager of a service
+type Config struct {
+	Type ServiceType
+	// Scope and User are only used by systemd. User is the owner of the user services, the updater user if empty
+	Scope Scope
+	User  string
+	// Runtime is only used by the container services, docker or podman. Detected if empty
+	Runtime string
+}
+
+// unsupportedService is returned by NewService for the service types of other platforms
+type unsupportedService struct {
+	serviceType ServiceType
+}
+
+func (s unsupportedService) err() error {
+	return fmt.Errorf("service type %s is %w on this platform", s.serviceType, ErrNotSupported)
+}
+
+func (s unsupportedService) Start(string) error            { return s.err() }
+func (s unsupportedService) Stop(string) error             { return s.err() }
+func (s unsupportedService) Restart(string) error          { return s.err() }
+func (s unsupportedService) Reload(string) error           { return s.err() }
+func (s unsupportedService) Status(string) (Status, error) { return Status{}, s.err() }
+
+// run runs the service manager command and returns his output
+func run(name string, args ...string) (string, error) {
+	return runContext(context.Background(), name, args...)
+}
+
+func runContext(ctx context.Context, name string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("%s %s %s %w", name, strings.Join(args, " "), string(out), err)
 	}
+	return string(out), nil
 }
@@ -3,30 +3,227 @@
 package taskservice
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"os"
 	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
-type SystemctlService struct{}
+// SystemctlService manages the services of systemd. With the user scope the commands talk with the
+// service manager of User, the updater user if empty
+type SystemctlService struct {
+	Scope Scope
+	User  string
+}
 
 func (ts SystemctlService) Stop(name string) error {
-	cmd := exec.Command("systemctl", "stop", name)
+	return ts.systemctl("stop", name)
+}
+
+func (ts SystemctlService) Start(name string) error {
+	return ts.systemctl("start", name)
+}
+
+func (ts SystemctlService) Restart(name string) error {
+	return ts.systemctl("restart", name)
+}
+
+func (ts SystemctlService) Reload(name string) error {
+	return ts.systemctl("reload", name)
+}
+
+func (ts SystemctlService) DaemonReload() error {
+	return ts.systemctl("daemon-reload")
+}
+
+func (ts SystemctlService) Enable(name string) error {
+	return ts.systemctl("enable", name)
+}
+
+func (ts SystemctlService) Journal(name string, since time.Time, lines int) ([]string, error) {
+	cmd, err := ts.command("journalctl", "--unit", name, fmt.Sprintf("--since=@%d", since.Unix()),
+		"--lines", strconv.Itoa(lines), "--no-pager", "--quiet", "--output=short-iso")
+	if err != nil {
+		return nil, err
+	}
 	out, err := cmd.Output()
 	if err != nil {
-		return fmt.Errorf("systemctl stop %s %w", string(out), err)
+		return nil, fmt.Errorf("journalctl --unit %s %s %w", name, string(out), err)
+	}
+	text := strings.TrimRight(string(out), "\n")
+	if text == "" {
+		return nil, nil
+	}
+	return strings.Split(text, "\n"), nil
+}
+
+func (ts SystemctlService) systemctl(args ...string) error {
+	cmd, err := ts.command("systemctl", args...)
+	if err != nil {
+		return err
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s %s %w", strings.Join(args, " "), string(out), err)
 	}
 	return nil
 }
 
-func (ts SystemctlService) Start(name string) error {
-	cmd := exec.Command("systemctl", "start", name)
+// command returns a command of systemd, like systemctl or journalctl, for the scope of the service.
+// For the user scope the command gets the --user flag and the runtime directory and bus of the user
+func (ts SystemctlService) command(name string, args ...string) (*exec.Cmd, error) {
+	if ts.Scope != ScopeUser {
+		return exec.Command(name, args...), nil
+	}
+	cmd := exec.Command(name, append([]string{"--user"}, args...)...)
+	if err := setUserScope(cmd, ts.User); err != nil {
+		return nil, fmt.Errorf("%s --user %w", name, err)
+	}
+	return cmd, nil
+}
+
+// setUserScope makes the command reach the service manager of the user: it runs with his XDG_RUNTIME_DIR
+// and DBUS_SESSION_BUS_ADDRESS and, when he is not the updater user, as him
+func setUserScope(cmd *exec.Cmd, username string) error {
+	uid := os.Getuid()
+	env := os.Environ()
+	if username != "" {
+		u, err := user.Lookup(username)
+		if err != nil {
+			return err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return err
+		}
+		gid, err := strconv.Atoi(u.Gid)
+		if err != nil {
+			return err
+		}
+		if uid != os.Getuid() {
+			cmd.SysProcAttr = &syscall.SysProcAttr{
+				Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)},
+			}
+		}
+		env = append(env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	}
+	runtimeDir := fmt.Sprintf("/run/user/%d", uid)
+	cmd.Env = append(env,
+		"XDG_RUNTIME_DIR="+runtimeDir,
+		"DBUS_SESSION_BUS_ADDRESS=unix:path="+runtimeDir+"/bus",
+	)
+	return nil
+}
+
+// the format of the timestamps of systemctl show, the command runs with TZ=UTC
+const systemctlTimeLayout = "Mon 2006-01-02 15:04:05 MST"
+
+func (ts SystemctlService) Status(name string) (Status, error) {
+	cmd, err := ts.command("systemctl", "show", "--property=Type,ActiveState,SubState,Result,MainPID,ActiveEnterTimestamp", name)
+	if err != nil {
+		return Status{}, err
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, "TZ=UTC")
 	out, err := cmd.Output()
 	if err != nil {
-		return fmt.Errorf("systemctl start %s %w", string(out), err)
+		return Status{}, fmt.Errorf("systemctl show %s %s %w", name, string(out), err)
 	}
-	return nil
+	return parseSystemctlShow(out), nil
+}
+
+func parseSystemctlShow(out []byte) Status {
+	properties := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		k, v, found := strings.Cut(scanner.Text(), "=")
+		if found {
+			properties[k] = strings.TrimSpace(v)
+		}
+	}
+
+	status := Status{SubState: properties["SubState"], Result: properties["Result"], Type: properties["Type"]}
+	switch properties["ActiveState"] {
+	case "active", "reloading":
+		status.State = StateActive
+	case "activating":
+		status.State = StateActivating
+		return status
+	case "failed":
+		status.State = StateFailed
+		return status
+	default:
+		status.State = StateInactive
+		return status
+	}
+	status.MainPID, _ = strconv.Atoi(properties["MainPID"])
+	if startedAt, err := time.Parse(systemctlTimeLayout, properties["ActiveEnterTimestamp"]); err == nil {
+		status.StartedAt = startedAt
+	}
+	return status
+}
+
+// DefaultServiceType returns the service manager detected on the host, systemd if none is found.
+// The detection runs once
+var DefaultServiceType = sync.OnceValue(detectServiceType)
+
+func detectServiceType() ServiceType {
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	inPath := func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	}
+	switch {
+	case exists("/run/systemd/system"):
+		return Systemctl
+	case exists("/run/openrc") && inPath("rc-service"):
+		return OpenRC
+	case exists("/etc/supervisord.conf") || exists("/etc/supervisor/supervisord.conf"):
+		if inPath("supervisorctl") {
+			return Supervisord
+		}
+	}
+	if (exists("/etc/service") || exists("/var/service")) && inPath("sv") {
+		return Runit
+	}
+	return Systemctl
+}
+
+// New returns the service manager of the config
+func New(config Config) Service {
+	switch config.Type {
+	case Systemctl:
+		return SystemctlService{Scope: config.Scope, User: config.User}
+	case Container:
+		return ContainerService{Runtime: config.Runtime}
+	}
+	return NewService(config.Type)
 }
 
 func NewService(service ServiceType) Service {
-	return SystemctlService{}
+	switch service {
+	case Systemctl:
+		return SystemctlService{}
+	case OpenRC:
+		return OpenRCService{}
+	case Runit:
+		return RunitService{}
+	case Supervisord:
+		return SupervisordService{}
+	case Container:
+		return ContainerService{}
+	default:
+		return unsupportedService{serviceType: service}
+	}
 }
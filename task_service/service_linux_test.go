@@ -0,0 +1,135 @@
+package taskservice_test
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	taskservice "github.com/ross96D/updater/task_service"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCLI puts on PATH a script named name that prints output and exits with code
+func fakeCLI(t *testing.T, name string, output string, code int) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncat <<'EOF'\n" + output + "\nEOF\nexit " + strconv.Itoa(code) + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestServiceStatus(t *testing.T) {
+	inputs := []struct {
+		name        string
+		serviceType taskservice.ServiceType
+		cli         string
+		output      string
+		code        int
+		state       taskservice.State
+		pid         int
+		uptime      time.Duration
+	}{
+		{name: "openrc started", serviceType: taskservice.OpenRC, cli: "rc-service", output: " * status: started", state: taskservice.StateActive},
+		{name: "openrc stopped", serviceType: taskservice.OpenRC, cli: "rc-service", output: " * status: stopped", code: 3, state: taskservice.StateInactive},
+		{name: "openrc crashed", serviceType: taskservice.OpenRC, cli: "rc-service", output: " * status: crashed", code: 1, state: taskservice.StateFailed},
+		{
+			name: "runit run", serviceType: taskservice.Runit, cli: "sv",
+			output: "run: app: (pid 123) 45s; run: log: (pid 120) 50s", state: taskservice.StateActive, pid: 123, uptime: 45 * time.Second,
+		},
+		{name: "runit down", serviceType: taskservice.Runit, cli: "sv", output: "down: app: 3s, normally up", state: taskservice.StateInactive},
+		{name: "runit fail", serviceType: taskservice.Runit, cli: "sv", output: "fail: app: unable to change to service directory", state: taskservice.StateFailed},
+		{
+			name: "supervisord running", serviceType: taskservice.Supervisord, cli: "supervisorctl",
+			output: "app                              RUNNING   pid 4321, uptime 1 day, 0:01:02", state: taskservice.StateActive,
+			pid: 4321, uptime: 24*time.Hour + 62*time.Second,
+		},
+		{name: "supervisord stopped", serviceType: taskservice.Supervisord, cli: "supervisorctl", output: "app STOPPED Not started", code: 3, state: taskservice.StateInactive},
+		{name: "supervisord backoff", serviceType: taskservice.Supervisord, cli: "supervisorctl", output: "app BACKOFF Exited too quickly", code: 3, state: taskservice.StateFailed},
+	}
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			fakeCLI(t, input.cli, input.output, input.code)
+			status, err := taskservice.NewService(input.serviceType).Status("app")
+			require.NoError(t, err)
+			require.Equal(t, input.state, status.State)
+			require.Equal(t, input.pid, status.MainPID)
+			if input.uptime != 0 {
+				require.WithinDuration(t, time.Now().Add(-input.uptime), status.StartedAt, 2*time.Second)
+			}
+		})
+	}
+
+	fakeCLI(t, "systemctl", "Type=oneshot\nActiveState=inactive\nSubState=dead\nResult=success", 0)
+	status, err := taskservice.NewService(taskservice.Systemctl).Status("app.service")
+	require.NoError(t, err)
+	require.Equal(t, taskservice.Status{State: taskservice.StateInactive, SubState: "dead", Result: "success", Type: "oneshot"}, status)
+
+	// an output that can not be parsed is an error even if the command succeeds
+	fakeCLI(t, "rc-service", "unexpected", 0)
+	_, err = taskservice.NewService(taskservice.OpenRC).Status("app")
+	require.ErrorContains(t, err, "unexpected output")
+	fakeCLI(t, "supervisorctl", "other RUNNING pid 1, uptime 0:00:01", 0)
+	_, err = taskservice.NewService(taskservice.Supervisord).Status("app")
+	require.ErrorContains(t, err, "unexpected output")
+
+	fakeCLI(t, "sv", "fail: other: no such service", 1)
+	_, err = taskservice.NewService(taskservice.Runit).Status("other")
+	require.Error(t, err)
+}
+
+func TestServiceTypeFrom(t *testing.T) {
+	require.Equal(t, taskservice.OpenRC, taskservice.ServiceTypeFrom("openrc"))
+	require.Equal(t, taskservice.Runit, taskservice.ServiceTypeFrom("runit"))
+	require.Equal(t, taskservice.Supervisord, taskservice.ServiceTypeFrom("supervisord"))
+	require.Equal(t, taskservice.Systemctl, taskservice.ServiceTypeFrom("systemd"))
+	require.Equal(t, taskservice.DefaultServiceType(), taskservice.ServiceTypeFrom(""))
+}
+
+func TestSystemctlUserScope(t *testing.T) {
+	dir := t.TempDir()
+	record := filepath.Join(dir, "record")
+	script := "#!/bin/sh\necho \"$@\" >> " + record + "\necho \"$XDG_RUNTIME_DIR $DBUS_SESSION_BUS_ADDRESS\" >> " + record + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "systemctl"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	current, err := user.Current()
+	require.NoError(t, err)
+	runtimeDir := "/run/user/" + current.Uid
+
+	service := taskservice.New(taskservice.Config{Type: taskservice.Systemctl, Scope: taskservice.ScopeUser, User: current.Username})
+	require.NoError(t, service.Stop("app.service"))
+	require.NoError(t, service.(taskservice.UnitManager).DaemonReload())
+	require.NoError(t, taskservice.New(taskservice.Config{Type: taskservice.Systemctl}).Start("app.service"))
+
+	out, err := os.ReadFile(record)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	require.Equal(t, []string{
+		"--user stop app.service",
+		runtimeDir + " unix:path=" + runtimeDir + "/bus",
+		"--user daemon-reload",
+		runtimeDir + " unix:path=" + runtimeDir + "/bus",
+		"start app.service",
+		os.Getenv("XDG_RUNTIME_DIR") + " " + os.Getenv("DBUS_SESSION_BUS_ADDRESS"),
+	}, lines)
+
+	err = taskservice.New(taskservice.Config{Type: taskservice.Systemctl, Scope: taskservice.ScopeUser, User: "updater-unknown-user"}).Start("app.service")
+	require.Error(t, err)
+}
+
+func TestSystemctlJournal(t *testing.T) {
+	fakeCLI(t, "journalctl", "2024-01-01T00:00:00+0000 host app[42]: listen tcp :80: bind: address already in use\n2024-01-01T00:00:00+0000 host systemd[1]: app.service: Failed with result 'exit-code'.", 0)
+	since := time.Now()
+	lines, err := taskservice.SystemctlService{}.Journal("app.service", since, 50)
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[1], "Failed with result")
+
+	fakeCLI(t, "journalctl", "", 0)
+	lines, err = taskservice.SystemctlService{}.Journal("app.service", since, 50)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+}
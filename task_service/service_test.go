@@ -0,0 +1,61 @@
+package taskservice_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	taskservice "github.com/ross96D/updater/task_service"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeService returns the statuses in order, repeating the last one
+type fakeService struct {
+	taskservice.Service
+	statuses []taskservice.Status
+}
+
+func (f *fakeService) Status(string) (taskservice.Status, error) {
+	status := f.statuses[0]
+	if len(f.statuses) > 1 {
+		f.statuses = f.statuses[1:]
+	}
+	return status, nil
+}
+
+func TestWaitReady(t *testing.T) {
+	activating := taskservice.Status{State: taskservice.StateActivating, SubState: "start"}
+	active := taskservice.Status{State: taskservice.StateActive, SubState: "running"}
+	failed := taskservice.Status{State: taskservice.StateFailed, SubState: "failed", Result: "exit-code"}
+
+	inputs := []struct {
+		name     string
+		statuses []taskservice.Status
+		ready    bool
+	}{
+		{name: "active", statuses: []taskservice.Status{activating, active}, ready: true},
+		{name: "oneshot", statuses: []taskservice.Status{{State: taskservice.StateInactive, Result: "success", Type: "oneshot"}}, ready: true},
+		{name: "exits 0", statuses: []taskservice.Status{{State: taskservice.StateInactive, Result: "success", Type: "simple"}}},
+		{name: "dies while settling", statuses: []taskservice.Status{active, failed}},
+		{name: "restarting", statuses: []taskservice.Status{{State: taskservice.StateActivating, SubState: "auto-restart"}}},
+		{name: "timeout", statuses: []taskservice.Status{activating}},
+	}
+	for _, input := range inputs {
+		t.Run(input.name, func(t *testing.T) {
+			service := &fakeService{statuses: input.statuses}
+			err := taskservice.WaitReady(context.Background(), service, "app.service", 500*time.Millisecond, 300*time.Millisecond)
+			if input.ready {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, taskservice.ErrServiceNotReady)
+			}
+		})
+	}
+}
+
+func TestNewContainerRuntime(t *testing.T) {
+	service := taskservice.New(taskservice.Config{Type: taskservice.Container, Runtime: "podman"})
+	require.Equal(t, taskservice.ContainerService{Runtime: "podman"}, service)
+	service = taskservice.New(taskservice.Config{Type: taskservice.Container})
+	require.Equal(t, taskservice.ContainerService{}, service)
+}
@@ -3,7 +3,10 @@
 package taskservice
 
 import (
+	"errors"
+	"fmt"
 	"os/exec"
+	"strings"
 
 	"github.com/ross96D/taskmaster"
 	"github.com/rs/zerolog/log"
@@ -47,6 +50,39 @@ func (ts *TaskService) Start(path string) error {
 	return err
 }
 
+func (ts *TaskService) Status(path string) (Status, error) {
+	if path == "" {
+		return Status{}, errors.New("task path is empty")
+	}
+	task, err := ts.service.GetRegisteredTask(path)
+	if err != nil {
+		return Status{}, err
+	}
+	if task.State != taskmaster.TASK_STATE_RUNNING {
+		if task.LastTaskResult != taskmaster.SCHED_S_SUCCESS && !task.LastRunTime.IsZero() {
+			return Status{State: StateFailed}, nil
+		}
+		return Status{State: StateInactive}, nil
+	}
+	status := Status{State: StateActive, StartedAt: task.LastRunTime}
+	instances, err := task.GetInstances()
+	if err == nil && len(instances) > 0 {
+		status.MainPID = int(instances[0].EnginePID)
+	}
+	return status, nil
+}
+
+func (ts *TaskService) Restart(path string) error {
+	if err := ts.Stop(path); err != nil {
+		return err
+	}
+	return ts.Start(path)
+}
+
+func (ts *TaskService) Reload(path string) error {
+	return fmt.Errorf("task scheduler reload %w", ErrNotSupported)
+}
+
 func get() (*TaskService, error) {
 	var err error
 	if ts == nil {
@@ -69,7 +105,45 @@ func (NNSMService) Start(name string) error {
 	return exec.Command("nssm", "start", name).Run()
 }
 
+func (NNSMService) Restart(name string) error {
+	return exec.Command("nssm", "restart", name).Run()
+}
+
+func (NNSMService) Reload(name string) error {
+	return fmt.Errorf("nssm reload %w", ErrNotSupported)
+}
+
+func (NNSMService) Status(name string) (Status, error) {
+	out, err := exec.Command("nssm", "status", name).Output()
+	if err != nil {
+		return Status{}, err
+	}
+	if strings.TrimSpace(string(out)) == "SERVICE_RUNNING" {
+		return Status{State: StateActive}, nil
+	}
+	return Status{State: StateInactive}, nil
+}
+
+// DefaultServiceType is the service type used when the configuration does not set one
+func DefaultServiceType() ServiceType {
+	return TaskSched
+}
+
+// New returns the service manager of the config. The scope and the user are not used on windows
+func New(config Config) Service {
+	if config.Type == Container {
+		return ContainerService{Runtime: config.Runtime}
+	}
+	return NewService(config.Type)
+}
+
 func NewService(service ServiceType) Service {
+	if service == Container {
+		return ContainerService{}
+	}
+	if service != NNSM && service != TaskSched {
+		return unsupportedService{serviceType: service}
+	}
 	if service == NNSM {
 		return NNSMService{}
 	} else {
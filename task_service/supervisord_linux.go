@@ -0,0 +1,71 @@
+//go:build linux
+
+package taskservice
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SupervisordService manages the programs of supervisord with supervisorctl
+type SupervisordService struct{}
+
+func (SupervisordService) Start(name string) error {
+	_, err := run("supervisorctl", "start", name)
+	return err
+}
+
+func (SupervisordService) Stop(name string) error {
+	_, err := run("supervisorctl", "stop", name)
+	return err
+}
+
+func (SupervisordService) Restart(name string) error {
+	_, err := run("supervisorctl", "restart", name)
+	return err
+}
+
+// Reload sends a HUP to the program
+func (SupervisordService) Reload(name string) error {
+	_, err := run("supervisorctl", "signal", "HUP", name)
+	return err
+}
+
+var supervisordUptimeRegex = regexp.MustCompile(`pid (\d+), uptime (?:(\d+) days?, )?(\d+):(\d+):(\d+)`)
+
+// Status parses the output of supervisorctl status, like "app RUNNING pid 123, uptime 1 day, 0:01:02".
+// The exit code is not 0 for the programs that are not running
+func (SupervisordService) Status(name string) (Status, error) {
+	out, err := run("supervisorctl", "status", name)
+	fields := strings.Fields(out)
+	if len(fields) < 2 || fields[0] != name {
+		if err == nil {
+			err = fmt.Errorf("supervisorctl status %s unexpected output %q", name, out)
+		}
+		return Status{}, err
+	}
+	status := Status{SubState: strings.ToLower(fields[1])}
+	switch fields[1] {
+	case "RUNNING":
+		status.State = StateActive
+		if match := supervisordUptimeRegex.FindStringSubmatch(out); match != nil {
+			status.MainPID, _ = strconv.Atoi(match[1])
+			var uptime time.Duration
+			for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+				n, _ := strconv.Atoi(match[i+2])
+				uptime += time.Duration(n) * unit
+			}
+			status.StartedAt = time.Now().Add(-uptime).Truncate(time.Second)
+		}
+	case "STARTING":
+		status.State = StateActivating
+	case "BACKOFF", "FATAL", "UNKNOWN":
+		status.State = StateFailed
+	default:
+		status.State = StateInactive
+	}
+	return status, nil
+}